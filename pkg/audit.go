@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const defaultAuditRequestMaxBytes = 1024
+
+// AuditRecord is an audit trail entry for one call of an audited method
+type AuditRecord struct {
+	Actor     string     // who made the call, from AuditActorFunc
+	Method    string     // full method name
+	Timestamp time.Time  // when the call started
+	Request   string     // the request as json with LogRequestBodiesRedactedFields masked, empty for streams
+	Code      codes.Code // the result
+	Error     string     // the error message if the call failed
+}
+
+// AuditSink receives audit records, implement it to send the audit trail somewhere durable
+type AuditSink interface {
+	Audit(ctx context.Context, record AuditRecord)
+}
+
+// NewLogAuditSink creates an audit sink that logs records at info level
+func NewLogAuditSink(entry *logrus.Entry) *LogAuditSink {
+	return &LogAuditSink{entry: entry}
+}
+
+type LogAuditSink struct {
+	entry *logrus.Entry
+}
+
+func (l *LogAuditSink) Audit(ctx context.Context, record AuditRecord) {
+	l.entry.WithFields(logrus.Fields{
+		"actor":     record.Actor,
+		"method":    record.Method,
+		"timestamp": record.Timestamp,
+		"request":   record.Request,
+		"code":      record.Code.String(),
+		"error":     record.Error,
+	}).Info("audit")
+}
+
+// auditor sends an audit record to the sink for every call of an audited method
+type auditor struct {
+	methods    map[string]bool
+	sink       AuditSink
+	actorFunc  func(ctx context.Context) string
+	bodyLogger *bodyLogger
+}
+
+func newAuditor(entry *logrus.Entry, methods []string, sink AuditSink, actorFunc func(ctx context.Context) string, redactedFields []string) *auditor {
+	methodSet := map[string]bool{}
+	for _, method := range methods {
+		methodSet[method] = true
+	}
+	if sink == nil {
+		sink = NewLogAuditSink(entry)
+	}
+	if actorFunc == nil {
+		actorFunc = PeerIP
+	}
+	return &auditor{
+		methods:   methodSet,
+		sink:      sink,
+		actorFunc: actorFunc,
+		// only used to marshal requests, with the same redaction as body logging
+		bodyLogger: newBodyLogger(entry, redactedFields, defaultAuditRequestMaxBytes),
+	}
+}
+
+func (a *auditor) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !a.methods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	request, _ := a.bodyLogger.marshal(req)
+	a.audit(ctx, info.FullMethod, start, request, err)
+	return resp, err
+}
+
+func (a *auditor) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !a.methods[info.FullMethod] {
+		return handler(srv, ss)
+	}
+	start := time.Now()
+	err := handler(srv, ss)
+	a.audit(ss.Context(), info.FullMethod, start, "", err)
+	return err
+}
+
+func (a *auditor) audit(ctx context.Context, method string, start time.Time, request string, err error) {
+	record := AuditRecord{
+		Actor:     a.actorFunc(ctx),
+		Method:    method,
+		Timestamp: start,
+		Request:   request,
+		Code:      status.Code(err),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	a.sink.Audit(ctx, record)
+}
@@ -0,0 +1,159 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"sync"
+)
+
+// AuthFailureReason is the reason label of the auth failure counter
+type AuthFailureReason string
+
+const (
+	AuthFailureMissingToken      AuthFailureReason = "missing_token"
+	AuthFailureInvalidToken      AuthFailureReason = "invalid_token"
+	AuthFailureExpiredToken      AuthFailureReason = "expired_token"
+	AuthFailureInsufficientScope AuthFailureReason = "insufficient_scope"
+	AuthFailureOther             AuthFailureReason = "other"
+)
+
+// AuthError is an error carrying an auth failure reason, return it from an AuthFunc to label the failure precisely
+type AuthError struct {
+	Reason AuthFailureReason
+	Status *status.Status
+}
+
+// NewAuthError creates an auth error with the given reason, code, and message
+func NewAuthError(reason AuthFailureReason, code codes.Code, message string) *AuthError {
+	return &AuthError{
+		Reason: reason,
+		Status: status.New(code, message),
+	}
+}
+
+func (e *AuthError) Error() string {
+	return e.Status.Err().Error()
+}
+
+// GRPCStatus lets grpc return the wrapped status to the client
+func (e *AuthError) GRPCStatus() *status.Status {
+	return e.Status
+}
+
+// authFailureReason classifies the auth error. AuthErrors carry their own reason, otherwise a missing authorization
+// header is a missing token, PermissionDenied is insufficient scope, and Unauthenticated is an invalid token.
+func authFailureReason(ctx context.Context, err error) AuthFailureReason {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr.Reason
+	}
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		if md, ok := metadata.FromIncomingContext(ctx); !ok || len(md.Get("authorization")) == 0 {
+			return AuthFailureMissingToken
+		}
+		return AuthFailureInvalidToken
+	case codes.PermissionDenied:
+		return AuthFailureInsufficientScope
+	}
+	return AuthFailureOther
+}
+
+// authFailureRecorder counts auth failures by method and reason
+type authFailureRecorder struct {
+	failures *prometheus.CounterVec
+}
+
+func newAuthFailureRecorder(namespace string) *authFailureRecorder {
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_auth_failures_total",
+		Help:      "Total number of RPCs rejected by authentication or authorization, by method and reason.",
+	}, []string{"grpc_method", "reason"})
+	return &authFailureRecorder{
+		failures: registerCollector(failures).(*prometheus.CounterVec),
+	}
+}
+
+// authFuncHolder holds the current auth func so that it can be swapped while requests are in flight
+type authFuncHolder struct {
+	lock     sync.RWMutex
+	authFunc grpc_auth.AuthFunc
+}
+
+func (h *authFuncHolder) get() grpc_auth.AuthFunc {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.authFunc
+}
+
+func (h *authFuncHolder) set(authFunc grpc_auth.AuthFunc) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.authFunc = authFunc
+}
+
+// SetAuthFunc replaces the auth func used for new requests, e.g. to rotate keys without a restart. Requests already
+// being authenticated finish with the old func. The auth interceptor is only in the chain when the server was created
+// with an AuthFunc, so this has no effect on servers created without one. nil is ignored so that a mistake can't turn
+// auth off.
+func (s *GrpcServer) SetAuthFunc(authFunc grpc_auth.AuthFunc) {
+	if authFunc == nil {
+		s.log.Warn("ignoring nil auth func")
+		return
+	}
+	s.authFunc.set(authFunc)
+	s.log.Info("auth func replaced")
+}
+
+// getAuthFunc returns an auth func calling the current auth func, wrapped to observe failures
+func (s *GrpcServer) getAuthFunc() grpc_auth.AuthFunc {
+	return func(ctx context.Context) (context.Context, error) {
+		newCtx, err := s.authFunc.get()(ctx)
+		if err != nil {
+			s.onAuthFailure(ctx, err)
+		}
+		return newCtx, err
+	}
+}
+
+// onAuthFailure logs the failure with the peer ip, counts it, and calls the OnAuthFailure hook. The metric isn't
+// labelled by ip to bound its cardinality, use the logs or the hook to track ips.
+func (s *GrpcServer) onAuthFailure(ctx context.Context, err error) {
+	method, _ := grpc.Method(ctx)
+	reason := authFailureReason(ctx, err)
+	s.log.WithError(err).WithFields(logrus.Fields{
+		"method":  method,
+		"peer_ip": PeerIP(ctx),
+		"reason":  reason,
+	}).Warn("request rejected by auth")
+	if s.authFailureRecorder != nil {
+		s.authFailureRecorder.failures.WithLabelValues(method, string(reason)).Inc()
+	}
+	if s.Config.OnAuthFailure != nil {
+		s.Config.OnAuthFailure(ctx, method, err)
+	}
+}
+
+// PeerIP returns the ip of the client that made the request, or an empty string if it's unknown. With ProxyProtocol
+// enabled it's the real client ip reported by the load balancer.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
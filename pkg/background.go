@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+)
+
+// Go runs fn in the background for the lifetime of the server. It starts when the server runs, or immediately if it's
+// already running, and the context is canceled on shutdown. Shutdown waits for fn to return, so fn must respect the
+// context. Panics are recovered and logged.
+func (s *GrpcServer) Go(fn func(ctx context.Context)) {
+	s.jobsLock.Lock()
+	defer s.jobsLock.Unlock()
+	if !s.running {
+		s.pendingJobs = append(s.pendingJobs, fn)
+		return
+	}
+	s.startJob(fn)
+}
+
+// Stop shuts the server down and waits for shutdown to complete, the same as receiving an os signal while running
+func (s *GrpcServer) Stop() {
+	s.closeShutDown()
+	s.wg.Wait()
+}
+
+// startPendingJobs starts the jobs added before the server was running
+func (s *GrpcServer) startPendingJobs() {
+	s.jobsLock.Lock()
+	defer s.jobsLock.Unlock()
+	s.running = true
+	for _, fn := range s.pendingJobs {
+		s.startJob(fn)
+	}
+	s.pendingJobs = nil
+}
+
+// startJob runs fn in a goroutine tracked by the server's wait group
+func (s *GrpcServer) startJob(fn func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if p := recover(); p != nil {
+				errorutils.LogOnErr(s.log, "recovered panic in background job", fmt.Errorf("%v", p))
+			}
+		}()
+		fn(s.backgroundCtx)
+	}()
+}
+
+// closeShutDown starts shutdown, it's safe to call more than once
+func (s *GrpcServer) closeShutDown() {
+	s.shutDownOnce.Do(func() {
+		close(s.shutDown)
+		s.cancelBackground()
+	})
+}
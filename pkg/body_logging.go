@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultLogRequestBodiesMaxBytes = 4096
+const redactedValue = "[REDACTED]"
+
+// bodyLogger logs request and response protos as json at debug level, redacting configured fields
+type bodyLogger struct {
+	entry          *logrus.Entry
+	redactedFields map[string]bool
+	maxBytes       int
+}
+
+func newBodyLogger(entry *logrus.Entry, redactedFields []string, maxBytes int) *bodyLogger {
+	fields := map[string]bool{}
+	for _, field := range redactedFields {
+		fields[field] = true
+	}
+	return &bodyLogger{
+		entry:          entry,
+		redactedFields: fields,
+		maxBytes:       maxBytes,
+	}
+}
+
+// unaryInterceptor logs the request and response bodies of unary calls
+func (l *bodyLogger) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	l.log(ctx, info.FullMethod, "request", req)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		l.log(ctx, info.FullMethod, "response", resp)
+	}
+	return resp, err
+}
+
+// streamInterceptor logs every message received and sent on a stream
+func (l *bodyLogger) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &bodyLoggingServerStream{ServerStream: ss, logger: l, method: info.FullMethod})
+}
+
+// log logs the message if debug logging is enabled, including any request context tags
+func (l *bodyLogger) log(ctx context.Context, method, direction string, msg interface{}) {
+	if !l.entry.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		// don't pay for marshalling if nobody will see it
+		return
+	}
+	body, truncated := l.marshal(msg)
+	l.entry.WithFields(grpc_ctxtags.Extract(ctx).Values()).WithFields(logrus.Fields{
+		"method":    method,
+		"direction": direction,
+		"body":      body,
+		"truncated": truncated,
+	}).Debug("grpc message body")
+}
+
+// marshal marshals the message to json with redacted fields masked, capped at maxBytes. Returns the json and whether
+// it was truncated.
+func (l *bodyLogger) marshal(msg interface{}) (string, bool) {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return "<non-proto message>", false
+	}
+	if l.maxBytes > 0 && proto.Size(protoMsg) > l.maxBytes*4 {
+		// the json will be truncated anyway, don't marshal huge payloads just to throw most of it away
+		return "<message too large to log>", true
+	}
+	marshalled, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(protoMsg)
+	if err != nil {
+		return "<error marshalling message>", false
+	}
+	if len(l.redactedFields) > 0 {
+		marshalled = l.redact(marshalled)
+	}
+	if l.maxBytes > 0 && len(marshalled) > l.maxBytes {
+		return string(marshalled[:l.maxBytes]), true
+	}
+	return string(marshalled), false
+}
+
+// redact replaces the values of redacted fields anywhere in the json document
+func (l *bodyLogger) redact(marshalled []byte) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(marshalled, &doc); err != nil {
+		return []byte(redactedValue)
+	}
+	redacted, err := json.Marshal(l.redactValue(doc))
+	if err != nil {
+		return []byte(redactedValue)
+	}
+	return redacted
+}
+
+func (l *bodyLogger) redactValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range typed {
+			if l.redactedFields[key] {
+				typed[key] = redactedValue
+			} else {
+				typed[key] = l.redactValue(nested)
+			}
+		}
+	case []interface{}:
+		for i, nested := range typed {
+			typed[i] = l.redactValue(nested)
+		}
+	}
+	return value
+}
+
+// bodyLoggingServerStream wraps a server stream to log messages as they're sent and received
+type bodyLoggingServerStream struct {
+	grpc.ServerStream
+	logger *bodyLogger
+	method string
+}
+
+func (s *bodyLoggingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.logger.log(s.Context(), s.method, "request", m)
+	}
+	return err
+}
+
+func (s *bodyLoggingServerStream) SendMsg(m interface{}) error {
+	s.logger.log(s.Context(), s.method, "response", m)
+	return s.ServerStream.SendMsg(m)
+}
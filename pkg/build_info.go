@@ -0,0 +1,26 @@
+package pkg
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"runtime"
+)
+
+// maybeRegisterBuildInfo registers a build_info gauge that's always 1, labelled with the configured build info and the
+// go version
+func (s *GrpcServer) maybeRegisterBuildInfo() {
+	if !s.Config.PrometheusEnabled || len(s.Config.BuildInfo) == 0 {
+		return
+	}
+	labels := prometheus.Labels{"go_version": runtime.Version()}
+	for name, value := range s.Config.BuildInfo {
+		labels[name] = value
+	}
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   s.metricsNamespace(),
+		Name:        "build_info",
+		Help:        "A metric with a constant '1' value labelled by the build info of the service.",
+		ConstLabels: labels,
+	})
+	buildInfo.Set(1)
+	registerCollector(buildInfo)
+}
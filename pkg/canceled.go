@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// canceledNormalizer rewrites the status of calls whose client has gone away to codes.Canceled, so that handlers that
+// don't check their context don't produce noisy Unknown or Internal errors
+type canceledNormalizer struct {
+	canceled *prometheus.CounterVec
+}
+
+func newCanceledNormalizer(namespace string) *canceledNormalizer {
+	canceled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_canceled_total",
+		Help:      "Total number of RPCs whose context was canceled by the client before the handler returned.",
+	}, []string{"grpc_method"})
+	return &canceledNormalizer{
+		canceled: registerCollector(canceled).(*prometheus.CounterVec),
+	}
+}
+
+func (n *canceledNormalizer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, n.normalize(ctx, info.FullMethod, err)
+}
+
+func (n *canceledNormalizer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	return n.normalize(ss.Context(), info.FullMethod, err)
+}
+
+// normalize returns a Canceled status if the context was canceled, otherwise the original error
+func (n *canceledNormalizer) normalize(ctx context.Context, method string, err error) error {
+	if ctx.Err() != context.Canceled {
+		return err
+	}
+	n.canceled.WithLabelValues(method).Inc()
+	if status.Code(err) == codes.Canceled {
+		return err
+	}
+	return status.Error(codes.Canceled, "request canceled by client")
+}
@@ -0,0 +1,24 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"time"
+)
+
+const defaultDialLocalTimeout = 5 * time.Second
+
+// DialLocal connects to a plaintext server at addr, e.g. localhost:6000, for local testing. It blocks until the
+// connection is up or 5 seconds pass, and compresses requests with gzip. opts are applied after the defaults so they
+// can override them. Never use it for production traffic, the connection is not encrypted.
+func DialLocal(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDialLocalTimeout)
+	defer cancel()
+	dialOpts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+	}
+	return grpc.DialContext(ctx, addr, append(dialOpts, opts...)...)
+}
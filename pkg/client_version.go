@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/mod/semver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+const defaultClientVersionMetadataKey = "x-client-version"
+
+// clientVersionChecker rejects clients older than the configured minimum semver version
+type clientVersionChecker struct {
+	minVersion    string
+	metadataKey   string
+	exempt        map[string]bool
+	rejectMissing bool
+}
+
+func newClientVersionChecker(minVersion, metadataKey string, exemptMethods []string, rejectMissing bool) (*clientVersionChecker, error) {
+	canonical := canonicalSemver(minVersion)
+	if !semver.IsValid(canonical) {
+		return nil, fmt.Errorf("invalid min client version %q, must be a semver version", minVersion)
+	}
+	exempt := map[string]bool{}
+	for _, method := range exemptMethods {
+		exempt[method] = true
+	}
+	return &clientVersionChecker{
+		minVersion:    canonical,
+		metadataKey:   metadataKey,
+		exempt:        exempt,
+		rejectMissing: rejectMissing,
+	}, nil
+}
+
+func (c *clientVersionChecker) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := c.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (c *clientVersionChecker) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := c.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// check returns a FailedPrecondition error if the client's version is too old, or missing and missing versions are
+// rejected
+func (c *clientVersionChecker) check(ctx context.Context, fullMethod string) error {
+	if c.exempt[fullMethod] || strings.HasPrefix(fullMethod, "/"+healthServiceName+"/") {
+		return nil
+	}
+	version := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(c.metadataKey); len(values) > 0 {
+			version = values[0]
+		}
+	}
+	if version == "" {
+		if c.rejectMissing {
+			return status.Errorf(codes.FailedPrecondition, "client version is required, send it in the %s header with a version of at least %s", c.metadataKey, c.minVersion)
+		}
+		return nil
+	}
+	canonical := canonicalSemver(version)
+	if !semver.IsValid(canonical) {
+		return status.Errorf(codes.FailedPrecondition, "client version %q is not a valid semver version", version)
+	}
+	if semver.Compare(canonical, c.minVersion) < 0 {
+		return status.Errorf(codes.FailedPrecondition, "client version %s is no longer supported, please upgrade to at least %s", version, c.minVersion)
+	}
+	return nil
+}
+
+// canonicalSemver adds the v prefix the semver package requires
+func canonicalSemver(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
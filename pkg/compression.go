@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"google.golang.org/grpc/encoding/gzip" // importing registers the gzip compressor, enables clients to use gzip compression
+)
+
+// maybeSetGzipLevel sets the gzip compression level if one is configured. The gzip compressor is registered globally by
+// grpc, so the level applies to every server in the process.
+func (s *GrpcServer) maybeSetGzipLevel() error {
+	if s.Config.GzipCompressionLevel == 0 {
+		return nil
+	}
+	s.log.WithField("gzip_compression_level", s.Config.GzipCompressionLevel).Info("setting gzip compression level")
+	return gzip.SetLevel(s.Config.GzipCompressionLevel)
+}
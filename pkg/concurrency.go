@@ -0,0 +1,121 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// concurrencyLimiter rejects requests once the max number of in flight requests is reached. Streams count for their
+// whole lifetime.
+type concurrencyLimiter struct {
+	semaphore chan struct{}
+}
+
+func newConcurrencyLimiter(maxConcurrentRequests int) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		semaphore: make(chan struct{}, maxConcurrentRequests),
+	}
+}
+
+func (l *concurrencyLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !l.acquire() {
+		return nil, status.Error(codes.Unavailable, "server is at max concurrent requests")
+	}
+	// deferred so the slot is released even if the handler panics
+	defer l.release()
+	return handler(ctx, req)
+}
+
+func (l *concurrencyLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !l.acquire() {
+		return status.Error(codes.Unavailable, "server is at max concurrent requests")
+	}
+	// deferred so the slot is released even if the handler panics
+	defer l.release()
+	return handler(srv, ss)
+}
+
+// acquire takes a slot without blocking, returns false if none are available
+func (l *concurrencyLimiter) acquire() bool {
+	select {
+	case l.semaphore <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	<-l.semaphore
+}
+
+// methodConcurrencyLimiter caps in flight requests per method so expensive methods can't starve cheap ones. Requests
+// over a method's limit wait up to the queue timeout for a slot, waiting requests get slots in the order they arrived,
+// then get ResourceExhausted.
+type methodConcurrencyLimiter struct {
+	semaphores   map[string]chan struct{}
+	queueTimeout time.Duration
+}
+
+func newMethodConcurrencyLimiter(limits map[string]int, queueTimeout time.Duration) *methodConcurrencyLimiter {
+	semaphores := map[string]chan struct{}{}
+	for method, limit := range limits {
+		if limit > 0 {
+			semaphores[method] = make(chan struct{}, limit)
+		}
+	}
+	return &methodConcurrencyLimiter{
+		semaphores:   semaphores,
+		queueTimeout: queueTimeout,
+	}
+}
+
+func (l *methodConcurrencyLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	semaphore, ok := l.semaphores[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	if err := l.acquire(ctx, semaphore, info.FullMethod); err != nil {
+		return nil, err
+	}
+	// deferred so the slot is released even if the handler panics
+	defer func() { <-semaphore }()
+	return handler(ctx, req)
+}
+
+func (l *methodConcurrencyLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	semaphore, ok := l.semaphores[info.FullMethod]
+	if !ok {
+		return handler(srv, ss)
+	}
+	if err := l.acquire(ss.Context(), semaphore, info.FullMethod); err != nil {
+		return err
+	}
+	// deferred so the slot is released even if the handler panics
+	defer func() { <-semaphore }()
+	return handler(srv, ss)
+}
+
+// acquire takes a slot for the method, waiting up to the queue timeout for one
+func (l *methodConcurrencyLimiter) acquire(ctx context.Context, semaphore chan struct{}, method string) error {
+	select {
+	case semaphore <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		select {
+		case semaphore <- struct{}{}:
+			return nil
+		case <-timer.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return status.Errorf(codes.ResourceExhausted, "%s is at its max concurrent requests", method)
+}
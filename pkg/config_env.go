@@ -0,0 +1,121 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// NewGrpcServerConfigFromEnv creates a config from environment variables and validates it. Unset variables leave the
+// field at its zero value so the usual defaults apply. The supported variables are:
+//
+//	GRPC_PORT                                 int
+//	GRPC_SENTRY_ENABLED                       bool
+//	GRPC_SENTRY_DSN                           string
+//	GRPC_SENTRY_ENVIRONMENT                   string
+//	GRPC_PROMETHEUS_ENABLED                   bool
+//	GRPC_PROMETHEUS_PATH                      string, defaults to /metrics
+//	GRPC_PROMETHEUS_PORT                      int
+//	GRPC_PROMETHEUS_ENABLE_LATENCY_HISTOGRAMS bool
+//	GRPC_TLS_CERT_PATH                        string
+//	GRPC_TLS_KEY_PATH                         string
+//	GRPC_TLS_CA_PATH                          string
+//	GRPC_MIN_TLS_VERSION                      one of 1.0, 1.1, 1.2, 1.3
+//	GRPC_MAX_CONNECTION_AGE                   duration, e.g. 30m
+//	GRPC_MAX_CONNECTION_AGE_GRACE             duration, e.g. 30s
+//	GRPC_MAX_CONCURRENT_REQUESTS              int
+//	GRPC_LOG_REQUEST_BODIES                   bool
+func NewGrpcServerConfigFromEnv() (GrpcServerConfig, error) {
+	parser := &envParser{}
+	config := GrpcServerConfig{
+		Port:                              parser.int("GRPC_PORT"),
+		SentryEnabled:                     parser.bool("GRPC_SENTRY_ENABLED"),
+		PrometheusEnabled:                 parser.bool("GRPC_PROMETHEUS_ENABLED"),
+		PrometheusPath:                    parser.string("GRPC_PROMETHEUS_PATH", "/metrics"),
+		PrometheusPort:                    parser.int("GRPC_PROMETHEUS_PORT"),
+		PrometheusEnableLatencyHistograms: parser.bool("GRPC_PROMETHEUS_ENABLE_LATENCY_HISTOGRAMS"),
+		TlsCertPath:                       parser.string("GRPC_TLS_CERT_PATH", ""),
+		TlsKeyPath:                        parser.string("GRPC_TLS_KEY_PATH", ""),
+		TlsCaPath:                         parser.string("GRPC_TLS_CA_PATH", ""),
+		MinTlsVersion:                     parser.tlsVersion("GRPC_MIN_TLS_VERSION"),
+		MaxConnectionAge:                  parser.duration("GRPC_MAX_CONNECTION_AGE"),
+		MaxConnectionAgeGrace:             parser.duration("GRPC_MAX_CONNECTION_AGE_GRACE"),
+		MaxConcurrentRequests:             parser.int("GRPC_MAX_CONCURRENT_REQUESTS"),
+		LogRequestBodies:                  parser.bool("GRPC_LOG_REQUEST_BODIES"),
+	}
+	config.SentryClientOptions.Dsn = parser.string("GRPC_SENTRY_DSN", "")
+	config.SentryClientOptions.Environment = parser.string("GRPC_SENTRY_ENVIRONMENT", "")
+	if parser.err != nil {
+		return GrpcServerConfig{}, parser.err
+	}
+	return config, config.Validate()
+}
+
+// envParser parses environment variables, keeping the first error so the caller can check once at the end
+type envParser struct {
+	err error
+}
+
+func (p *envParser) string(name, defaultValue string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func (p *envParser) int(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	intValue, err := strconv.Atoi(value)
+	p.setErr(name, value, err)
+	return intValue
+}
+
+func (p *envParser) bool(name string) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return false
+	}
+	boolValue, err := strconv.ParseBool(value)
+	p.setErr(name, value, err)
+	return boolValue
+}
+
+func (p *envParser) duration(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	p.setErr(name, value, err)
+	return duration
+}
+
+func (p *envParser) tlsVersion(name string) uint16 {
+	value := os.Getenv(name)
+	switch value {
+	case "":
+		return 0
+	case "1.0":
+		return tls.VersionTLS10
+	case "1.1":
+		return tls.VersionTLS11
+	case "1.2":
+		return tls.VersionTLS12
+	case "1.3":
+		return tls.VersionTLS13
+	}
+	p.setErr(name, value, fmt.Errorf("must be one of 1.0, 1.1, 1.2, 1.3"))
+	return 0
+}
+
+func (p *envParser) setErr(name, value string, err error) {
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+}
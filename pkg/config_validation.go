@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// namedInt is a config value and its field name, for validating several fields the same way
+type namedInt struct {
+	name  string
+	value int
+}
+
+// ConfigErrors is every problem found validating a config
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid gRPC server config: %s", strings.Join(messages, "; "))
+}
+
+// Is reports whether any of the errors matches target, so errors.Is can match any of them
+func (e ConfigErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets target to the first of the errors that matches it, so errors.As can match any of them
+func (e ConfigErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the config for misconfigurations, returning ConfigErrors with every problem found rather than just
+// the first. Zero values are valid where a default applies. Called by NewGrpcServer.
+func (c GrpcServerConfig) Validate() error {
+	errs := ConfigErrors{}
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	ports := []namedInt{{"Port", c.Port}, {"PrometheusPort", c.PrometheusPort}, {"GrpcWebPort", c.GrpcWebPort}}
+	for _, port := range ports {
+		if port.value < 0 || port.value > 65535 {
+			add("%s must be between 0 and 65535, got %d", port.name, port.value)
+		}
+	}
+	if c.PrometheusEnabled {
+		if c.PrometheusPort == 0 {
+			add("PrometheusPort must be set when prometheus is enabled")
+		} else if c.PrometheusPort == c.Port {
+			add("PrometheusPort and Port are both %d, the metrics server and the gRPC server need their own ports", c.Port)
+		}
+		if !strings.HasPrefix(c.PrometheusPath, "/") {
+			add("PrometheusPath must start with /, got %q", c.PrometheusPath)
+		}
+	}
+	if c.GrpcWebEnabled {
+		if c.GrpcWebPort == 0 {
+			add("GrpcWebPort must be set when grpc-web is enabled")
+		} else if c.GrpcWebPort == c.Port {
+			add("GrpcWebPort and Port are both %d, the grpc-web server and the gRPC server need their own ports", c.Port)
+		} else if c.PrometheusEnabled && c.GrpcWebPort == c.PrometheusPort {
+			add("GrpcWebPort and PrometheusPort are both %d, the grpc-web server and the metrics server need their own ports", c.GrpcWebPort)
+		}
+	}
+	tlsPathsSet := 0
+	for _, path := range []string{c.TlsCertPath, c.TlsKeyPath, c.TlsCaPath} {
+		if path != "" {
+			tlsPathsSet++
+		}
+	}
+	if tlsPathsSet > 0 && tlsPathsSet < 3 {
+		add("TlsCertPath, TlsKeyPath, and TlsCaPath must all be set to enable tls")
+	}
+	if tlsPathsSet > 0 && c.TlsPkcs12Path != "" {
+		add("TlsPkcs12Path can't be used with TlsCertPath, TlsKeyPath, and TlsCaPath")
+	}
+	if c.H2C && (tlsPathsSet > 0 || c.TlsPkcs12Path != "") {
+		add("H2C serves plaintext, it can't be used with TlsCertPath, TlsKeyPath, TlsCaPath, or TlsPkcs12Path")
+	}
+	h2Advertised := len(c.TlsNextProtos) == 0
+	for _, proto := range c.TlsNextProtos {
+		h2Advertised = h2Advertised || proto == "h2"
+	}
+	if !h2Advertised {
+		add("TlsNextProtos must include h2 for grpc, got %v", c.TlsNextProtos)
+	}
+	if c.PrometheusTlsEnabled && (c.PrometheusTlsCertPath == "") != (c.PrometheusTlsKeyPath == "") {
+		add("PrometheusTlsCertPath and PrometheusTlsKeyPath must be set together")
+	}
+	sizes := []namedInt{
+		{"MaxConcurrentRequests", c.MaxConcurrentRequests},
+		{"LogRequestBodiesMaxBytes", c.LogRequestBodiesMaxBytes},
+		{"TenantMaxCardinality", c.TenantMaxCardinality},
+		{"MaxMetadataBytes", c.MaxMetadataBytes},
+		{"GoroutineLeakThreshold", c.GoroutineLeakThreshold},
+		{"MaxStreamMessages", c.MaxStreamMessages},
+		{"MemoryStoreMaxEntries", c.MemoryStoreMaxEntries},
+	}
+	for _, size := range sizes {
+		if size.value < 0 {
+			add("%s must not be negative, got %d", size.name, size.value)
+		}
+	}
+	if c.DeadlineBudget.Percent < 0 || c.DeadlineBudget.Percent > 100 {
+		add("DeadlineBudget percent must be between 0 and 100, got %v", c.DeadlineBudget.Percent)
+	}
+	methods := make([]string, 0, len(c.MethodDeadlineBudgets))
+	for method := range c.MethodDeadlineBudgets {
+		methods = append(methods, method)
+	}
+	// sorted so the errors come out in the same order every time
+	sort.Strings(methods)
+	for _, method := range methods {
+		if percent := c.MethodDeadlineBudgets[method].Percent; percent < 0 || percent > 100 {
+			add("deadline budget percent for %s must be between 0 and 100, got %v", method, percent)
+		}
+	}
+	// nil entries would otherwise panic later, at startup, on some request, or during shutdown
+	for i, opt := range c.Opts {
+		if opt == nil {
+			add("Opts[%d] is nil", i)
+		}
+	}
+	for i, interceptor := range c.UnaryServerInterceptors {
+		if interceptor == nil {
+			add("UnaryServerInterceptors[%d] is nil", i)
+		}
+	}
+	for i, interceptor := range c.StreamServerInterceptors {
+		if interceptor == nil {
+			add("StreamServerInterceptors[%d] is nil", i)
+		}
+	}
+	for i, hook := range c.ShutdownHooks {
+		if hook == nil {
+			add("ShutdownHooks[%d] is nil", i)
+		}
+	}
+	names := make([]string, 0, len(c.DependencyCheckers))
+	for name := range c.DependencyCheckers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if c.DependencyCheckers[name].Check == nil {
+			add("DependencyCheckers[%q] has a nil Check", name)
+		}
+	}
+	debugPaths := make([]string, 0, len(c.DebugHandlers))
+	for path := range c.DebugHandlers {
+		debugPaths = append(debugPaths, path)
+	}
+	sort.Strings(debugPaths)
+	// http.ServeMux panics at startup on an empty, nil, or already served path
+	for _, path := range debugPaths {
+		if path == "" {
+			add("DebugHandlers has an empty path")
+		}
+		if c.DebugHandlers[path] == nil {
+			add("DebugHandlers[%q] is nil", path)
+		}
+		for _, reserved := range c.reservedMetricsPaths() {
+			if path == reserved {
+				add("DebugHandlers[%q] collides with a path the metrics server already serves", path)
+			}
+		}
+	}
+	if c.PrefaceTimeout < 0 {
+		add("PrefaceTimeout must not be negative, got %s", c.PrefaceTimeout)
+	}
+	if c.FaultInjection != nil && (c.FaultInjection.Probability < 0 || c.FaultInjection.Probability > 1) {
+		add("FaultInjection probability must be between 0 and 1, got %v", c.FaultInjection.Probability)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
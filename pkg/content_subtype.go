@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+const baseContentType = "application/grpc"
+
+// contentSubtypeChecker rejects requests whose codec isn't allowed, e.g. json over grpc. A plain application/grpc
+// content type is proto. The request has already been decoded when interceptors run, but the handler never sees it.
+type contentSubtypeChecker struct {
+	allowed map[string]bool
+}
+
+func newContentSubtypeChecker(allowedSubtypes []string) *contentSubtypeChecker {
+	allowed := map[string]bool{}
+	for _, subtype := range allowedSubtypes {
+		allowed[strings.ToLower(subtype)] = true
+	}
+	return &contentSubtypeChecker{
+		allowed: allowed,
+	}
+}
+
+func (c *contentSubtypeChecker) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (c *contentSubtypeChecker) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := c.check(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// check returns InvalidArgument if the request's content subtype isn't allowed
+func (c *contentSubtypeChecker) check(ctx context.Context) error {
+	subtype := "proto"
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("content-type"); len(values) > 0 {
+			// the transport has already validated the content type, it's application/grpc with an optional +subtype or
+			// ;subtype
+			if rest := strings.TrimPrefix(values[0], baseContentType); len(rest) > 1 {
+				subtype = strings.ToLower(rest[1:])
+			}
+		}
+	}
+	if c.allowed[subtype] {
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument, "content subtype %q is not allowed", subtype)
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/catalystsquad/app-utils-go/logging"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const defaultRequestIDMetadataKey = "x-request-id"
+
+type contextLoggerKey struct{}
+type requestIDContextKey struct{}
+
+// requestIDValue is the request id on the context, and whether it was generated rather than sent by the client
+type requestIDValue struct {
+	id        string
+	generated bool
+}
+
+// LoggerFromContext returns the request scoped logger added by the context logger interceptor, with the method,
+// request id, and peer fields. Returns a logger without request fields if there isn't one.
+func LoggerFromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(contextLoggerKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logging.Log)
+}
+
+// RequestIDFromContext returns the request id added by the context logger or error correlation interceptors, and whether
+// there was one
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	value, ok := ctx.Value(requestIDContextKey{}).(requestIDValue)
+	return value.id, ok
+}
+
+// contextLogger adds a request scoped logger and request id to the context. The request id is read from metadata so it
+// follows the request across services, or generated if the client didn't send one.
+type contextLogger struct {
+	entry                *logrus.Entry
+	requestIDMetadataKey string
+}
+
+func newContextLogger(entry *logrus.Entry, requestIDMetadataKey string) *contextLogger {
+	return &contextLogger{
+		entry:                entry,
+		requestIDMetadataKey: requestIDMetadataKey,
+	}
+}
+
+func (l *contextLogger) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(l.withLogger(ctx, info.FullMethod), req)
+}
+
+func (l *contextLogger) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = l.withLogger(ss.Context(), info.FullMethod)
+	return handler(srv, wrapped)
+}
+
+// withLogger returns a context carrying the request id and a logger with the request fields
+func (l *contextLogger) withLogger(ctx context.Context, method string) context.Context {
+	id, generated := requestID(ctx, l.requestIDMetadataKey)
+	fields := logrus.Fields{
+		"method":     method,
+		"request_id": id,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["peer"] = p.Addr.String()
+	}
+	ctx = withRequestID(ctx, id, generated)
+	return context.WithValue(ctx, contextLoggerKey{}, l.entry.WithFields(fields))
+}
+
+// requestID returns the request id already on the context, or from metadata, or a new random one, and whether it was
+// generated
+func requestID(ctx context.Context, requestIDMetadataKey string) (string, bool) {
+	if value, ok := ctx.Value(requestIDContextKey{}).(requestIDValue); ok {
+		return value.id, value.generated
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadataKey); len(values) > 0 && values[0] != "" {
+			return values[0], false
+		}
+	}
+	id := make([]byte, 16)
+	// crypto/rand doesn't fail on supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id), true
+}
+
+// withRequestID returns a context carrying the request id for RequestIDFromContext and later interceptors
+func withRequestID(ctx context.Context, id string, generated bool) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestIDValue{id: id, generated: generated})
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"context"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"time"
+)
+
+// DeadlineBudget is how much of the inbound deadline to hold back from downstream calls, leaving time for the
+// response trip. The reductions add up, e.g. 10% plus 50ms.
+type DeadlineBudget struct {
+	Percent float64       // percentage of the remaining time to hold back, between 0 and 100
+	Amount  time.Duration // fixed amount of time to hold back
+}
+
+type downstreamDeadlineContextKey struct{}
+
+// DownstreamContext returns a context to use for downstream calls, with the inbound deadline reduced by the configured
+// deadline budget. Returns a cancelable copy of ctx when there's no reduced deadline.
+func DownstreamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Value(downstreamDeadlineContextKey{}).(time.Time)
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// deadlineBudgetReducer computes the downstream deadline for each request from the inbound deadline
+type deadlineBudgetReducer struct {
+	defaultBudget DeadlineBudget
+	methodBudgets map[string]DeadlineBudget
+}
+
+func newDeadlineBudgetReducer(defaultBudget DeadlineBudget, methodBudgets map[string]DeadlineBudget) *deadlineBudgetReducer {
+	return &deadlineBudgetReducer{
+		defaultBudget: defaultBudget,
+		methodBudgets: methodBudgets,
+	}
+}
+
+func (r *deadlineBudgetReducer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(r.reduce(ctx, info.FullMethod), req)
+}
+
+func (r *deadlineBudgetReducer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = r.reduce(ss.Context(), info.FullMethod)
+	return handler(srv, wrapped)
+}
+
+// reduce stores the downstream deadline in the context if the inbound request has a deadline. The handler's own
+// deadline is left alone, only DownstreamContext sees the reduced one.
+func (r *deadlineBudgetReducer) reduce(ctx context.Context, method string) context.Context {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx
+	}
+	budget, ok := r.methodBudgets[method]
+	if !ok {
+		budget = r.defaultBudget
+	}
+	remaining := time.Until(deadline)
+	reduction := budget.Amount + time.Duration(float64(remaining)*budget.Percent/100)
+	return context.WithValue(ctx, downstreamDeadlineContextKey{}, deadline.Add(-reduction))
+}
+
+// deadlineBudgetEnabled returns true if any deadline budget is configured
+func (s *GrpcServer) deadlineBudgetEnabled() bool {
+	return s.Config.DeadlineBudget != (DeadlineBudget{}) || len(s.Config.MethodDeadlineBudgets) > 0
+}
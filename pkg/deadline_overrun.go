@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deadlineOverrunGuard counts handlers that are still running when their deadline passes. The handler's context is
+// canceled at the deadline so cooperative handlers stop on their own. Handlers always run on the request goroutine, so
+// locks and concurrency slots held by outer interceptors stay held until the handler actually returns, and a unary
+// call that overran returns DeadlineExceeded rather than a response the client has stopped waiting for.
+type deadlineOverrunGuard struct {
+	overruns *prometheus.CounterVec
+}
+
+func newDeadlineOverrunGuard(namespace string) *deadlineOverrunGuard {
+	overruns := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_deadline_overruns_total",
+		Help:      "Total number of RPCs whose handler was still running when the deadline passed.",
+	}, []string{"grpc_method"})
+	return &deadlineOverrunGuard{
+		overruns: registerCollector(overruns).(*prometheus.CounterVec),
+	}
+}
+
+func (g *deadlineOverrunGuard) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if ctx.Err() == context.DeadlineExceeded {
+		g.overruns.WithLabelValues(info.FullMethod).Inc()
+		return nil, status.Error(codes.DeadlineExceeded, "deadline exceeded while the handler was running")
+	}
+	return resp, err
+}
+
+func (g *deadlineOverrunGuard) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	if ss.Context().Err() == context.DeadlineExceeded {
+		g.overruns.WithLabelValues(info.FullMethod).Inc()
+	}
+	return err
+}
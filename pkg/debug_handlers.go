@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// debugHandlers holds the custom handlers served on the metrics port, so they can be registered before or after the
+// metrics server starts
+type debugHandlers struct {
+	lock     sync.Mutex
+	mux      *http.ServeMux
+	handlers map[string]http.Handler
+}
+
+// reservedMetricsPaths are the paths the metrics server serves itself, which debug handlers can't be served on
+func (c GrpcServerConfig) reservedMetricsPaths() []string {
+	paths := []string{c.PrometheusPath}
+	if c.LogLevelEndpointEnabled {
+		paths = append(paths, logLevelPath)
+	}
+	return paths
+}
+
+// RegisterDebugHandler serves the handler at the path on the metrics port, behind the same auth as the metrics, e.g.
+// for build info, feature flags, or queue depths. Handlers can be registered before or after Run(), they're only served
+// when prometheus is enabled. Returns an error if the path is already served, by the metrics server, by
+// Config.DebugHandlers, or by an earlier registration.
+func (s *GrpcServer) RegisterDebugHandler(path string, handler http.Handler) error {
+	if path == "" {
+		return fmt.Errorf("debug handler path must not be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("debug handler for %s is nil", path)
+	}
+	for _, reserved := range s.Config.reservedMetricsPaths() {
+		if path == reserved {
+			return fmt.Errorf("debug handler path %s is already served by the metrics server", path)
+		}
+	}
+	if _, ok := s.Config.DebugHandlers[path]; ok {
+		return fmt.Errorf("debug handler path %s is already in Config.DebugHandlers", path)
+	}
+	s.debugHandlers.lock.Lock()
+	defer s.debugHandlers.lock.Unlock()
+	if _, ok := s.debugHandlers.handlers[path]; ok {
+		return fmt.Errorf("multiple registrations for debug handler %s", path)
+	}
+	if s.debugHandlers.handlers == nil {
+		s.debugHandlers.handlers = map[string]http.Handler{}
+	}
+	s.debugHandlers.handlers[path] = handler
+	if s.debugHandlers.mux != nil {
+		s.debugHandlers.mux.Handle(path, s.metricsAuthHandler(handler))
+	}
+	return nil
+}
+
+// mountDebugHandlers serves the configured and registered debug handlers on the metrics mux, and serves handlers
+// registered later on it too. Collisions are rejected by Validate and RegisterDebugHandler, so the mux won't panic.
+func (s *GrpcServer) mountDebugHandlers(mux *http.ServeMux) {
+	s.debugHandlers.lock.Lock()
+	defer s.debugHandlers.lock.Unlock()
+	for path, handler := range s.Config.DebugHandlers {
+		mux.Handle(path, s.metricsAuthHandler(handler))
+	}
+	for path, handler := range s.debugHandlers.handlers {
+		mux.Handle(path, s.metricsAuthHandler(handler))
+	}
+	s.debugHandlers.mux = mux
+}
@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"time"
+)
+
+const defaultDependencyCheckInterval = 10 * time.Second
+
+// DependencyChecker checks a dependency such as a database or downstream service
+type DependencyChecker struct {
+	Check    func(ctx context.Context) error // returns an error if the dependency is unhealthy
+	Interval time.Duration                   // how often to run the check, defaults to DependencyCheckInterval
+	Timeout  time.Duration                   // how long each check may take before it fails, defaults to the interval
+}
+
+// maybeStartDependencyChecks runs each dependency checker in the background on its own interval, reporting each one as
+// a named health service so the overall status is NOT_SERVING while any of them fail. Only the default health server
+// is updated.
+func (s *GrpcServer) maybeStartDependencyChecks() {
+	if len(s.Config.DependencyCheckers) == 0 {
+		return
+	}
+	healthChecker, ok := s.Config.HealthServer.(*HealthChecker)
+	if !ok {
+		s.log.Warn("dependency checkers are configured but the health server is not the default, dependency health will not be reported")
+		return
+	}
+	for name, checker := range s.Config.DependencyCheckers {
+		if checker.Interval == 0 {
+			checker.Interval = s.Config.DependencyCheckInterval
+		}
+		if checker.Timeout == 0 {
+			checker.Timeout = checker.Interval
+		}
+		s.startDependencyCheck(name, checker, healthChecker)
+	}
+}
+
+// startDependencyCheck runs the checker immediately and then on its interval until shutdown
+func (s *GrpcServer) startDependencyCheck(name string, checker DependencyChecker, healthChecker *HealthChecker) {
+	s.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(checker.Interval)
+		defer ticker.Stop()
+		for {
+			s.checkDependency(ctx, name, checker, healthChecker)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// checkDependency runs the dependency checker once and updates its health status
+func (s *GrpcServer) checkDependency(ctx context.Context, name string, checker DependencyChecker, healthChecker *HealthChecker) {
+	checkCtx, cancel := context.WithTimeout(ctx, checker.Timeout)
+	defer cancel()
+	err := checker.Check(checkCtx)
+	if ctx.Err() != nil {
+		// shutting down, the check was likely canceled rather than failed
+		return
+	}
+	servingStatus := grpc_health_v1.HealthCheckResponse_SERVING
+	if err != nil {
+		servingStatus = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		s.log.WithError(err).WithFields(logrus.Fields{"dependency": name}).Warn("dependency health check failed")
+	}
+	healthChecker.SetServiceServingStatus(name, servingStatus)
+}
@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+const defaultDrainFilePollInterval = time.Second
+
+// maybeWatchDrainFile polls for the drain file and starts the graceful shutdown sequence once it exists, for
+// orchestrators that signal drain by touching a file
+func (s *GrpcServer) maybeWatchDrainFile() {
+	if s.Config.DrainFilePath == "" {
+		return
+	}
+	s.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(s.Config.DrainFilePollInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := os.Stat(s.Config.DrainFilePath); err == nil {
+				s.log.WithField("drain_file_path", s.Config.DrainFilePath).Info("drain file found, shutting down")
+				s.closeShutDown()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
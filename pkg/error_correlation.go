@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorCorrelator adds the request id to error responses, in the message and as a RequestInfo detail, and logs it with
+// the error so support can find the logs for an id a client quotes
+type errorCorrelator struct {
+	entry                *logrus.Entry
+	requestIDMetadataKey string
+}
+
+func newErrorCorrelator(entry *logrus.Entry, requestIDMetadataKey string) *errorCorrelator {
+	return &errorCorrelator{
+		entry:                entry,
+		requestIDMetadataKey: requestIDMetadataKey,
+	}
+}
+
+func (c *errorCorrelator) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id, generated := requestID(ctx, c.requestIDMetadataKey)
+	resp, err := handler(withRequestID(ctx, id, generated), req)
+	return resp, c.correlate(id, generated, info.FullMethod, err)
+}
+
+func (c *errorCorrelator) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id, generated := requestID(ss.Context(), c.requestIDMetadataKey)
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = withRequestID(ss.Context(), id, generated)
+	err := handler(srv, wrapped)
+	return c.correlate(id, generated, info.FullMethod, err)
+}
+
+// correlate logs the error with the request id and returns it with the request id attached, keeping any details. Logged
+// at warn level, like other rejected requests, since error level is captured in sentry. A generated id is also logged
+// as the correlation id, since it's only known from the error the client got.
+func (c *errorCorrelator) correlate(id string, generated bool, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	st := status.Convert(err)
+	if st.Code() == codes.OK {
+		return err
+	}
+	fields := logrus.Fields{
+		"method":     method,
+		"request_id": id,
+		"code":       st.Code().String(),
+	}
+	if generated {
+		fields["correlation_id"] = id
+	}
+	c.entry.WithError(err).WithFields(fields).Warn("request failed")
+	statusProto := st.Proto()
+	statusProto.Message = fmt.Sprintf("%s (correlation id: %s)", statusProto.Message, id)
+	return withDetails(status.FromProto(statusProto), &errdetails.RequestInfo{RequestId: id}).Err()
+}
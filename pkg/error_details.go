@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"time"
+)
+
+// FieldViolation creates a bad request field violation for NewValidationError
+func FieldViolation(field, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: description,
+	}
+}
+
+// PreconditionViolation creates a precondition failure violation for NewPreconditionFailedError
+func PreconditionViolation(violationType, subject, description string) *errdetails.PreconditionFailure_Violation {
+	return &errdetails.PreconditionFailure_Violation{
+		Type:        violationType,
+		Subject:     subject,
+		Description: description,
+	}
+}
+
+// QuotaViolation creates a quota failure violation for NewResourceExhaustedError
+func QuotaViolation(subject, description string) *errdetails.QuotaFailure_Violation {
+	return &errdetails.QuotaFailure_Violation{
+		Subject:     subject,
+		Description: description,
+	}
+}
+
+// NewValidationError creates an InvalidArgument status with a BadRequest detail listing the field violations
+func NewValidationError(message string, violations ...*errdetails.BadRequest_FieldViolation) *status.Status {
+	return newStatusWithDetails(codes.InvalidArgument, message, &errdetails.BadRequest{FieldViolations: violations})
+}
+
+// NewNotFoundError creates a NotFound status with a ResourceInfo detail identifying the missing resource
+func NewNotFoundError(resourceType, resourceName, message string) *status.Status {
+	return newStatusWithDetails(codes.NotFound, message, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Description:  message,
+	})
+}
+
+// NewAlreadyExistsError creates an AlreadyExists status with a ResourceInfo detail identifying the existing resource
+func NewAlreadyExistsError(resourceType, resourceName, message string) *status.Status {
+	return newStatusWithDetails(codes.AlreadyExists, message, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Description:  message,
+	})
+}
+
+// NewPreconditionFailedError creates a FailedPrecondition status with a PreconditionFailure detail listing the
+// violations
+func NewPreconditionFailedError(message string, violations ...*errdetails.PreconditionFailure_Violation) *status.Status {
+	return newStatusWithDetails(codes.FailedPrecondition, message, &errdetails.PreconditionFailure{Violations: violations})
+}
+
+// NewResourceExhaustedError creates a ResourceExhausted status with a QuotaFailure detail listing the violations, and a
+// RetryInfo detail if retryDelay is positive
+func NewResourceExhaustedError(message string, retryDelay time.Duration, violations ...*errdetails.QuotaFailure_Violation) *status.Status {
+	st := newStatusWithDetails(codes.ResourceExhausted, message, &errdetails.QuotaFailure{Violations: violations})
+	if retryDelay > 0 {
+		st = withDetails(st, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+	}
+	return st
+}
+
+// NewUnavailableError creates an Unavailable status with a RetryInfo detail telling clients when to retry
+func NewUnavailableError(message string, retryDelay time.Duration) *status.Status {
+	return newStatusWithDetails(codes.Unavailable, message, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+}
+
+// NewErrorInfoError creates a status with an ErrorInfo detail carrying a machine readable reason
+func NewErrorInfoError(code codes.Code, message, reason, domain string, metadata map[string]string) *status.Status {
+	return newStatusWithDetails(code, message, &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   domain,
+		Metadata: metadata,
+	})
+}
+
+func newStatusWithDetails(code codes.Code, message string, detail protoiface.MessageV1) *status.Status {
+	return withDetails(status.New(code, message), detail)
+}
+
+// withDetails adds the detail to the status. Details only fail to attach if they can't be marshalled, in which case
+// the status is returned without them rather than losing the error.
+func withDetails(st *status.Status, detail protoiface.MessageV1) *status.Status {
+	withDetail, err := st.WithDetails(detail)
+	if err != nil {
+		return st
+	}
+	return withDetail
+}
+
+// hasStatusDetails returns true if the error is a status with details attached
+func hasStatusDetails(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && len(st.Proto().GetDetails()) > 0
+}
@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// exemplarRecorder records handling time in a histogram with exemplars linking each observation to the active trace
+type exemplarRecorder struct {
+	traceIDFromContext func(ctx context.Context) string
+	handlingSeconds    *prometheus.HistogramVec
+}
+
+func newExemplarRecorder(namespace string, traceIDFromContext func(ctx context.Context) string) *exemplarRecorder {
+	if traceIDFromContext == nil {
+		traceIDFromContext = sentryTraceIDFromContext
+	}
+	handlingSeconds := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_traced_handling_seconds",
+		Help:      "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server, with trace exemplars.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+	return &exemplarRecorder{
+		traceIDFromContext: traceIDFromContext,
+		handlingSeconds:    registerCollector(handlingSeconds).(*prometheus.HistogramVec),
+	}
+}
+
+func (r *exemplarRecorder) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	r.observe(ctx, "unary", info.FullMethod, err, time.Since(start))
+	return resp, err
+}
+
+func (r *exemplarRecorder) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	r.observe(ss.Context(), streamType(info), info.FullMethod, err, time.Since(start))
+	return err
+}
+
+// observe records the duration, attaching the trace id as an exemplar when there is one
+func (r *exemplarRecorder) observe(ctx context.Context, grpcType, fullMethod string, err error, duration time.Duration) {
+	service, method := splitMethodName(fullMethod)
+	observer := r.handlingSeconds.WithLabelValues(grpcType, service, method, status.Code(err).String())
+	traceID := r.traceIDFromContext(ctx)
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && traceID != "" {
+		exemplarObserver.ObserveWithExemplar(duration.Seconds(), prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	observer.Observe(duration.Seconds())
+}
+
+// sentryTraceIDFromContext returns the trace id of the sentry transaction on the context, if any
+func sentryTraceIDFromContext(ctx context.Context) string {
+	transaction := sentry.TransactionFromContext(ctx)
+	if transaction == nil {
+		return ""
+	}
+	return transaction.TraceID.String()
+}
+
+// splitMethodName splits a full method name like /package.Service/Method into service and method
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
+
+// streamType returns the prometheus grpc_type label for a stream
+func streamType(info *grpc.StreamServerInfo) string {
+	if info.IsClientStream && info.IsServerStream {
+		return "bidi_stream"
+	} else if info.IsClientStream {
+		return "client_stream"
+	}
+	return "server_stream"
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FaultConfig injects latency and errors into requests for resilience testing. It's meant for test and staging
+// environments, never enable it in production.
+type FaultConfig struct {
+	Probability float64       // chance between 0 and 1 that a request gets a fault
+	Delay       time.Duration // latency added before the handler runs on faulted requests
+	Code        codes.Code    // code returned instead of calling the handler on faulted requests, OK only adds the delay
+	Methods     []string      // full method names to inject faults into, all methods when empty
+	Seed        int64         // seeds the random number generator so the faulted requests are reproducible, 0 uses the current time
+}
+
+// faultInjector decides which requests get a fault and applies it
+type faultInjector struct {
+	config  FaultConfig
+	methods map[string]bool
+	lock    sync.Mutex
+	rand    *rand.Rand
+}
+
+func newFaultInjector(log *logrus.Entry, config FaultConfig) *faultInjector {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	var methods map[string]bool
+	if len(config.Methods) > 0 {
+		methods = map[string]bool{}
+		for _, method := range config.Methods {
+			methods[method] = true
+		}
+	}
+	log.WithFields(logrus.Fields{
+		"probability": config.Probability,
+		"delay":       config.Delay,
+		"code":        config.Code.String(),
+		"methods":     config.Methods,
+	}).Warn("fault injection is enabled")
+	return &faultInjector{
+		config:  config,
+		methods: methods,
+		rand:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (f *faultInjector) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := f.maybeInject(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (f *faultInjector) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := f.maybeInject(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// maybeInject applies a fault to the request if it's selected, returning the error to respond with if any
+func (f *faultInjector) maybeInject(ctx context.Context, fullMethod string) error {
+	if f.methods != nil && !f.methods[fullMethod] {
+		return nil
+	}
+	if !f.selected() {
+		return nil
+	}
+	if f.config.Delay > 0 {
+		timer := time.NewTimer(f.config.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if f.config.Code != codes.OK {
+		return status.Error(f.config.Code, "injected fault")
+	}
+	return nil
+}
+
+// selected returns true if the next request should get a fault. rand.Rand isn't safe for concurrent use.
+func (f *faultInjector) selected() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.rand.Float64() < f.config.Probability
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"context"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"sync"
+	"time"
+)
+
+const defaultFeatureFlagRefreshInterval = 30 * time.Second
+
+// FeatureFlags are feature flag values by name
+type FeatureFlags map[string]bool
+
+// Enabled returns true if the flag is set and true, unknown flags are disabled
+func (f FeatureFlags) Enabled(name string) bool {
+	return f[name]
+}
+
+// FeatureFlagProvider loads the current feature flags from a config source, e.g. a config map or a flag service
+type FeatureFlagProvider interface {
+	Flags(ctx context.Context) (FeatureFlags, error)
+}
+
+type featureFlagsContextKey struct{}
+
+// FlagsFromContext returns the feature flags added by the feature flag interceptor. The flags are a snapshot taken
+// when the request started so they're consistent for the whole request. Returns nil, with every flag disabled, if there
+// aren't any.
+func FlagsFromContext(ctx context.Context) FeatureFlags {
+	flags, _ := ctx.Value(featureFlagsContextKey{}).(FeatureFlags)
+	return flags
+}
+
+// featureFlagHolder holds the latest flags from the provider and adds them to request contexts
+type featureFlagHolder struct {
+	lock  sync.RWMutex
+	flags FeatureFlags
+}
+
+func (h *featureFlagHolder) get() FeatureFlags {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.flags
+}
+
+func (h *featureFlagHolder) set(flags FeatureFlags) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.flags = flags
+}
+
+func (h *featureFlagHolder) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(context.WithValue(ctx, featureFlagsContextKey{}, h.get()), req)
+}
+
+func (h *featureFlagHolder) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = context.WithValue(ss.Context(), featureFlagsContextKey{}, h.get())
+	return handler(srv, wrapped)
+}
+
+// maybeLoadFeatureFlags loads the feature flags once so they're set before the first request, then refreshes them in
+// the background. Flags are copied so providers can reuse their map. Errors keep the previous flags.
+func (s *GrpcServer) maybeLoadFeatureFlags(ctx context.Context) {
+	if s.Config.FeatureFlagProvider == nil {
+		return
+	}
+	s.refreshFeatureFlags(ctx)
+	s.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(s.Config.FeatureFlagRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refreshFeatureFlags(ctx)
+			}
+		}
+	})
+}
+
+// refreshFeatureFlags loads the current flags from the provider
+func (s *GrpcServer) refreshFeatureFlags(ctx context.Context) {
+	flags, err := s.Config.FeatureFlagProvider.Flags(ctx)
+	if err != nil {
+		errorutils.LogOnErr(s.log, "error loading feature flags, keeping the previous flags", err)
+		return
+	}
+	copied := make(FeatureFlags, len(flags))
+	for name, value := range flags {
+		copied[name] = value
+	}
+	s.featureFlags.set(copied)
+}
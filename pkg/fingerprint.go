@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"runtime"
+	"strings"
+)
+
+// panicFingerprintFrames is how many application frames the default fingerprint uses
+const panicFingerprintFrames = 3
+
+// fingerprintedError carries a sentry fingerprint to the sentry event processor
+type fingerprintedError struct {
+	error
+	fingerprint []string
+}
+
+func (e *fingerprintedError) Unwrap() error {
+	return e.error
+}
+
+// fingerprintEventProcessor is a sentry event processor that applies the fingerprint of recovered panics, so panics
+// from the same place group into one sentry issue regardless of their message
+func fingerprintEventProcessor(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	var fingerprinted *fingerprintedError
+	if hint != nil && errors.As(hint.OriginalException, &fingerprinted) && len(event.Fingerprint) == 0 {
+		event.Fingerprint = fingerprinted.fingerprint
+	}
+	return event
+}
+
+// panicStack returns the stack of the panicking goroutine, starting at the frame that panicked. Must be called from
+// the recovery handler or another deferred recovery, while it's still running on the panicking stack.
+func panicStack() []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	stack := []runtime.Frame{}
+	panicked := false
+	for {
+		frame, more := frames.Next()
+		if panicked {
+			stack = append(stack, frame)
+		} else if frame.Function == "runtime.gopanic" {
+			panicked = true
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+// formatStack formats a stack from panicStack for logging, one frame per line
+func formatStack(stack []runtime.Frame) string {
+	lines := make([]string, len(stack))
+	for i, frame := range stack {
+		lines[i] = fmt.Sprintf("%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// defaultPanicFingerprint fingerprints a panic by the top application frames of its stack, ignoring the runtime
+func defaultPanicFingerprint(p interface{}, stack []runtime.Frame) []string {
+	fingerprint := []string{"recovered-panic"}
+	for _, frame := range stack {
+		if strings.HasPrefix(frame.Function, "runtime.") {
+			continue
+		}
+		fingerprint = append(fingerprint, fmt.Sprintf("%s:%d", frame.Function, frame.Line))
+		if len(fingerprint) > panicFingerprintFrames {
+			break
+		}
+	}
+	return fingerprint
+}
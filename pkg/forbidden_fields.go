@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+// forbiddenFieldsChecker rejects requests that set forbidden fields, e.g. fields that are being removed from a proto
+type forbiddenFieldsChecker struct {
+	methodFields map[string][][]string
+}
+
+// newForbiddenFieldsChecker creates a checker from dot separated field paths by full method name, e.g. "filter.legacy_id"
+func newForbiddenFieldsChecker(forbiddenFields map[string][]string) *forbiddenFieldsChecker {
+	methodFields := map[string][][]string{}
+	for method, paths := range forbiddenFields {
+		for _, path := range paths {
+			methodFields[method] = append(methodFields[method], strings.Split(path, "."))
+		}
+	}
+	return &forbiddenFieldsChecker{
+		methodFields: methodFields,
+	}
+}
+
+func (c *forbiddenFieldsChecker) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := c.check(info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (c *forbiddenFieldsChecker) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if _, ok := c.methodFields[info.FullMethod]; !ok {
+		return handler(srv, ss)
+	}
+	return handler(srv, &forbiddenFieldsServerStream{ServerStream: ss, checker: c, method: info.FullMethod})
+}
+
+// check returns InvalidArgument if the message sets any of the method's forbidden fields
+func (c *forbiddenFieldsChecker) check(method string, msg interface{}) error {
+	paths, ok := c.methodFields[method]
+	if !ok {
+		return nil
+	}
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	for _, path := range paths {
+		if fieldSet(protoMsg.ProtoReflect(), path) {
+			return status.Errorf(codes.InvalidArgument, "field %s is no longer supported", strings.Join(path, "."))
+		}
+	}
+	return nil
+}
+
+// fieldSet returns true if the field at the path is populated. Paths descend through singular message fields, unknown
+// field names are never set.
+func fieldSet(msg protoreflect.Message, path []string) bool {
+	field := msg.Descriptor().Fields().ByName(protoreflect.Name(path[0]))
+	if field == nil || !msg.Has(field) {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	if field.Kind() != protoreflect.MessageKind || field.Cardinality() == protoreflect.Repeated {
+		return false
+	}
+	return fieldSet(msg.Get(field).Message(), path[1:])
+}
+
+// forbiddenFieldsServerStream checks every message received on a stream for forbidden fields
+type forbiddenFieldsServerStream struct {
+	grpc.ServerStream
+	checker *forbiddenFieldsChecker
+	method  string
+}
+
+func (s *forbiddenFieldsServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+	return s.checker.check(s.method, m)
+}
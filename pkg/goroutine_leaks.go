@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"runtime"
+)
+
+// goroutineLeakDetector warns when the process has more goroutines after a handler than before it by more than the
+// threshold, a sign the handler left goroutines running. The count is process wide so concurrent requests add noise,
+// set the threshold well above the normal concurrency.
+type goroutineLeakDetector struct {
+	entry     *logrus.Entry
+	threshold int
+	leaks     *prometheus.CounterVec
+}
+
+func newGoroutineLeakDetector(entry *logrus.Entry, namespace string, threshold int) *goroutineLeakDetector {
+	leaks := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_goroutine_leaks_total",
+		Help:      "Total number of RPCs after which the goroutine count grew by more than the leak threshold.",
+	}, []string{"grpc_method"})
+	return &goroutineLeakDetector{
+		entry:     entry,
+		threshold: threshold,
+		leaks:     registerCollector(leaks).(*prometheus.CounterVec),
+	}
+}
+
+func (d *goroutineLeakDetector) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	before := runtime.NumGoroutine()
+	resp, err := handler(ctx, req)
+	d.check(info.FullMethod, before)
+	return resp, err
+}
+
+func (d *goroutineLeakDetector) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	before := runtime.NumGoroutine()
+	err := handler(srv, ss)
+	d.check(info.FullMethod, before)
+	return err
+}
+
+// check warns and counts a leak if the goroutine count grew by more than the threshold
+func (d *goroutineLeakDetector) check(method string, before int) {
+	delta := runtime.NumGoroutine() - before
+	if delta <= d.threshold {
+		return
+	}
+	d.leaks.WithLabelValues(method).Inc()
+	d.entry.WithFields(logrus.Fields{
+		"method":          method,
+		"goroutine_delta": delta,
+	}).Warn("handler may have leaked goroutines")
+}
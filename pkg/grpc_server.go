@@ -1,67 +1,229 @@
 package pkg
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/catalystsquad/app-utils-go/errorutils"
 	"github.com/catalystsquad/app-utils-go/logging"
-	sentryutils "github.com/catalystsquad/app-utils-go/sentry"
 	"github.com/getsentry/sentry-go"
-	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
-	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/pires/go-proxyproto"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
-	_ "google.golang.org/grpc/encoding/gzip" // import for side effects, enables clients to use gzip compression
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
 	"sync"
+	"time"
 )
 
-var shutDown = make(chan struct{})
-var runError = make(chan error)
-var wg = new(sync.WaitGroup)
-
 type GrpcServer struct {
-	Config GrpcServerConfig
-	Server *grpc.Server
+	Config               GrpcServerConfig
+	Server               *grpc.Server
+	log                  *logrus.Entry
+	tenantTagger         *tenantTagger
+	exemplarRecorder     *exemplarRecorder
+	messageSizeRecorder  *messageSizeRecorder
+	certificateHolder    *certificateHolder
+	sessionTicketConfig  *tls.Config // set when session ticket keys are configured, handshakes use it so keys can be rotated
+	concurrencyLimiter   *concurrencyLimiter
+	methodLimiter        *methodConcurrencyLimiter
+	authFailureRecorder  *authFailureRecorder
+	authFunc             authFuncHolder
+	panicRecorder        *panicRecorder
+	debugHandlers        debugHandlers
+	featureFlags         featureFlagHolder
+	sentryHub            *sentry.Hub // set when sentry is enabled, events from this server are captured through it
+	maintenanceMode      maintenanceMode
+	disabledMethods      disabledMethods
+	clientVersionChecker *clientVersionChecker
+	faultInjector        *faultInjector
+	activeGauges         *activeGaugesHandler
+	shuttingDown         int32
+	forceStopped         int32
+	shutDown             chan struct{}
+	shutDownOnce         sync.Once
+	runError             chan error
+	wg                   sync.WaitGroup
+	backgroundCtx        context.Context
+	cancelBackground     context.CancelFunc
+	jobsLock             sync.Mutex
+	running              bool
+	pendingJobs          []func(ctx context.Context)
+	metricsServer        *http.Server
+	grpcWebServer        *http.Server
+	unaryInterceptor     grpc.UnaryServerInterceptor
+	streamInterceptor    grpc.StreamServerInterceptor
+	enabledUnary         []registeredUnaryInterceptor
+	enabledStream        []registeredStreamInterceptor
+	unaryNames           []string // names of the interceptors in the unary chain, outermost first
+	streamNames          []string // names of the interceptors in the stream chain, outermost first
 }
 
 type GrpcServerConfig struct {
-	Port                               int                   // port to run on
-	SentryEnabled                      bool                  // enable sentry integration
-	SentryClientOptions                sentry.ClientOptions  // arbitrary sentry client options to pass through to sentry client
-	PrometheusEnabled                  bool                  // enable prometheus metrics
-	PrometheusPath                     string                // path to enable prometheus metrics on
-	PrometheusPort                     int                   // port to run prometheus metrics on
-	PrometheusEnableLatencyHistograms  bool                  // enable prometheus latency histograms
-	GetErrorToReturn                   func(err error) error // called when recovering from a panic, gets the error to return to the caller
-	CaptureRecoveredErr                func(err error) bool  // called when recovering from a panic, return true to capture the error in sentry
-	CaptureErrormessage                string                // error message logged when recovering from a panic
-	Opts                               []grpc.ServerOption   // arbitrary options to pass through to the server
-	TlsCertPath, TlsKeyPath, TlsCaPath string                // file paths to tls cert, key, and ca, if all 3 are provided then the server runs with tls enabled
-	MinTlsVersion                      uint16                // minimum tls version to use, defaults to 1.0
+	ServiceName                        string                                              // name of the service, added to logs and sentry events
+	ServiceNameMetricsNamespace        bool                                                // prefix metrics created by this package with the service name
+	Port                               int                                                 // port to run on
+	SentryEnabled                      bool                                                // enable sentry integration, each server gets its own sentry client and hub, see SentryHub
+	SentryClientOptions                sentry.ClientOptions                                // arbitrary sentry client options to pass through to sentry client
+	PrometheusEnabled                  bool                                                // enable prometheus metrics
+	PrometheusPath                     string                                              // path to enable prometheus metrics on
+	PrometheusPort                     int                                                 // port to run prometheus metrics on
+	PrometheusEnableLatencyHistograms  bool                                                // enable prometheus latency histograms
+	GetErrorToReturn                   func(err error) error                               // called when recovering from a panic, gets the error to return to the caller
+	GetErrorToReturnFromPanic          func(p interface{}) error                           // called when recovering from a panic with the original panic value, takes precedence over GetErrorToReturn
+	CaptureRecoveredErr                func(err error) bool                                // called when recovering from a panic, return true to capture the error in sentry
+	PanicFingerprint                   func(p interface{}, stack []runtime.Frame) []string // called when recovering from a panic, returns the sentry fingerprint to group the event by, defaults to the top application stack frames
+	DisableRecovery                    bool                                                // don't recover panics in handlers, a panic crashes the whole process and every in flight rpc, so the orchestrator restarts it
+	CaptureErrormessage                string                                              // error message logged when recovering from a panic
+	Opts                               []grpc.ServerOption                                 // arbitrary options to pass through to the server
+	TlsCertPath, TlsKeyPath, TlsCaPath string                                              // file paths to tls cert, key, and ca, if all 3 are provided then the server runs with tls enabled
+	MinTlsVersion                      uint16                                              // minimum tls version to use, defaults to 1.0
 	UnaryServerInterceptors            []grpc.UnaryServerInterceptor
 	StreamServerInterceptors           []grpc.StreamServerInterceptor
 	AuthFunc                           grpc_auth.AuthFunc
+	OnAuthFailure                      func(ctx context.Context, method string, err error) // called when AuthFunc rejects a request, e.g. to alert on or block the peer ip from PeerIP
 	HealthServer                       grpc_health_v1.HealthServer
+	MaxConnectionAge                   time.Duration                          // maximum age of a connection before the server sends a GOAWAY, 0 means infinite
+	MaxConnectionAgeGrace              time.Duration                          // time allowed for in flight rpcs to complete after MaxConnectionAge, 0 means infinite
+	LogRequestBodies                   bool                                   // log request and response protos as json at debug level
+	LogRequestBodiesRedactedFields     []string                               // proto field names whose values are masked when logging bodies
+	LogRequestBodiesMaxBytes           int                                    // maximum number of bytes of each body to log, defaults to 4096
+	ReuseAddr                          bool                                   // set SO_REUSEADDR on gRPC listeners so a restart doesn't fail with address already in use
+	ReusePort                          bool                                   // set SO_REUSEPORT on gRPC listeners so several processes can listen on the same port
+	ProxyProtocol                      bool                                   // accept PROXY protocol headers from a load balancer so peer addresses reflect the real client
+	TenantMetadataKey                  string                                 // metadata key carrying the tenant id, when set requests are tagged with their tenant
+	TenantAllowlist                    []string                               // tenants allowed as metric label values, others are labelled "other"
+	TenantMaxCardinality               int                                    // max distinct tenant label values when no allowlist is set, defaults to 100
+	PrometheusEnableMessageSizes       bool                                   // record histograms of request and response message sizes by method
+	BuildInfo                          map[string]string                      // labels of a constant build_info metric, e.g. version and commit, the go version is added automatically
+	PrometheusEnableExemplars          bool                                   // record a latency histogram with trace id exemplars, which are served to scrapers that negotiate the OpenMetrics format
+	ExemplarTraceIDFromContext         func(ctx context.Context) string       // returns the trace id for exemplars, defaults to the sentry transaction trace id
+	NormalizeCanceledStatus            bool                                   // return codes.Canceled when the client canceled the request before the handler returned
+	AdditionalListeners                []ListenerConfig                       // additional listeners serving the same services, each with their own tls settings
+	UnknownServiceHandler              grpc.StreamHandler                     // handles calls to unregistered services instead of returning Unimplemented
+	MaxConcurrentRequests              int                                    // max in flight requests across all methods, additional requests get Unavailable, 0 means unlimited
+	CtxTagsEnabled                     bool                                   // add grpc_ctxtags to the request context so downstream logging includes request derived fields
+	CtxTagsFieldExtractor              grpc_ctxtags.RequestFieldExtractorFunc // extracts tags from requests when ctx tags are enabled
+	ContextLoggerEnabled               bool                                   // add a request scoped logger with method, request id, and peer fields to the context, see LoggerFromContext
+	RequestIDMetadataKey               string                                 // metadata key carrying the request id, a random one is generated when it's missing, defaults to x-request-id
+	ErrorCorrelationEnabled            bool                                   // add the request id to error responses, in the message and as a RequestInfo detail, and log it with the error
+	PrometheusTlsEnabled               bool                                   // serve metrics over https, using the gRPC server certificate unless a metrics cert and key are provided
+	PrometheusTlsCertPath              string                                 // file path to a cert for the metrics endpoint
+	PrometheusTlsKeyPath               string                                 // file path to a key for the metrics endpoint
+	PrometheusBasicAuthUsername        string                                 // when set with a password, scrapes must use basic auth
+	PrometheusBasicAuthPassword        string                                 // basic auth password for the metrics endpoint
+	LogLevelEndpointEnabled            bool                                   // serve /loglevel on the metrics port to get the log level, or set it with a PUT of a level name, protected by the metrics auth
+	PrometheusBearerToken              string                                 // when set, scrapes must send this bearer token
+	GracefulStopTimeout                time.Duration                          // how long to wait for in flight rpcs to finish on shutdown before forcing the server to stop, defaults to 30 seconds
+	ShutdownHooks                      []func(ctx context.Context) error      // run in order on shutdown after the gRPC server has stopped, e.g. to flush buffers and close db pools
+	ShutdownHookTimeout                time.Duration                          // how long each shutdown hook's context lasts, defaults to 10 seconds
+	MetricsShutdownDelay               time.Duration                          // how long to keep serving metrics after the gRPC server stops so a final scrape succeeds, set to at least the scrape interval
+	MinClientVersion                   string                                 // minimum semver client version, older clients get FailedPrecondition with an upgrade message
+	ClientVersionMetadataKey           string                                 // metadata key carrying the client version, defaults to x-client-version
+	ClientVersionExemptMethods         []string                               // full method names exempt from the client version check
+	RejectMissingClientVersion         bool                                   // reject requests without a client version, by default they're allowed
+	FailIfNoServices                   bool                                   // return an error from Run() if no services besides health are registered
+	IdempotencyMetadataKey             string                                 // metadata key carrying the idempotency key, when set repeated unary requests return the stored response
+	IdempotencyTTL                     time.Duration                          // how long responses are stored for idempotency, defaults to 10 minutes
+	IdempotencyStore                   IdempotencyStore                       // where responses are stored for idempotency, defaults to an in-memory store
+	IdempotencyScopeFunc               func(ctx context.Context) string       // returns the caller identity idempotency keys are scoped to, e.g. from the context set by AuthFunc, defaults to the tenant, or the peer ip without one
+	TlsPkcs12Path                      string                                 // file path to a PKCS#12 (.p12/.pfx) bundle with the cert, key, and optionally the ca chain, used instead of the pem paths
+	TlsPkcs12Password                  string                                 // password for the PKCS#12 bundle
+	TlsSessionTicketKeys               [][32]byte                             // session ticket keys shared across replicas so clients can resume sessions against any of them, the first key encrypts new tickets
+	TlsSessionTicketsDisabled          bool                                   // disable tls session resumption with session tickets
+	TlsOcspStaple                      []byte                                 // DER encoded OCSP response to staple to the served certificate
+	TlsOcspResponseURL                 string                                 // url returning a DER encoded OCSP response to staple, fetched at startup and refreshed periodically
+	TlsOcspRefreshInterval             time.Duration                          // how often to refresh the OCSP staple from the url, defaults to 1 hour
+	StateStore                         StateStore                             // shared store for interceptor state, when set it backs idempotency unless an IdempotencyStore is configured, and the response cache
+	CachedMethods                      map[string]time.Duration               // full method names of unary read methods whose successful responses are cached by request for the ttl, responses must not depend on the caller
+	CacheControlMetadataKey            string                                 // metadata key where clients send no-cache or no-store directives to bypass the response cache, defaults to cache-control
+	GrpcWebEnabled                     bool                                   // serve the grpc server wrapped with grpc-web over http/1.1 so browsers can call it
+	GrpcWebPort                        int                                    // port to serve grpc-web on
+	GrpcWebAllowedOrigins              []string                               // cors origins allowed to call grpc-web, "*" allows all
+	GrpcWebAllowedHeaders              []string                               // additional request headers allowed by cors for grpc-web
+	GrpcWebWebsocketsEnabled           bool                                   // serve grpc-web over websockets too, which supports client and bidi streaming from browsers
+	GrpcWebWebsocketPingInterval       time.Duration                          // how often to ping idle grpc-web websockets to keep them alive, 0 disables pings
+	OnConnection                       func(net.Conn, *tls.ConnectionState)   // called for every connection once its tls handshake is done, with the tls state or nil for plaintext connections, it runs before the connection serves requests so it should return quickly
+	CoalescedMethods                   []string                               // full method names of read methods where identical concurrent requests share one handler execution
+	DeadlineBudget                     DeadlineBudget                         // how much of the inbound deadline to hold back from downstream calls made with DownstreamContext
+	MethodDeadlineBudgets              map[string]DeadlineBudget              // deadline budgets by full method name, overriding DeadlineBudget
+	DependencyCheckers                 map[string]DependencyChecker           // checked in the background on their own intervals, the default health server reports NOT_SERVING while any fail, each is also reported as a named health service
+	DependencyCheckInterval            time.Duration                          // how often to run dependency checkers that don't set their own interval, defaults to 10 seconds
+	EmitServerTimingTrailers           bool                                   // send a grpc-server-processing-time trailer with the handler duration in milliseconds
+	DrainFilePath                      string                                 // when the file at this path exists the server drains and shuts down, as if it received an os signal
+	DrainFilePollInterval              time.Duration                          // how often to check for the drain file, defaults to 1 second
+	GzipCompressionLevel               int                                    // gzip level from compress/gzip used to compress responses to clients that accept gzip, e.g. gzip.BestSpeed, 0 leaves the default level
+	ForbiddenFields                    map[string][]string                    // dot separated field paths by full method name, requests that set them get InvalidArgument
+	DisabledMethodCode                 codes.Code                             // code returned for methods disabled with SetMethodEnabled, defaults to Unimplemented
+	ResponseHeaders                    metadata.MD                            // headers set on every response, e.g. server name, version, and region
+	ResourceLockKey                    ResourceLockKeyFunc                    // returns the resource key unary requests are serialized on within this process, requests with the same key run one at a time
+	ResourceLockTimeout                time.Duration                          // how long a request waits for its resource lock before getting Aborted, defaults to 10 seconds
+	MaxMetadataBytes                   int                                    // max request metadata size, larger requests get ResourceExhausted, keep it below the transport header list size limit
+	ReflectionEnabled                  bool                                   // register the grpc reflection service so tools like grpcurl can discover the api
+	ReflectionServiceFilter            func(serviceName string) bool          // returns false for services to hide from reflection, hidden services are still callable
+	GoroutineLeakThreshold             int                                    // warn when the goroutine count grows by more than this across a handler, 0 disables the check
+	RetryPushback                      time.Duration                          // sent as the grpc-retry-pushback-ms trailer on Unavailable and ResourceExhausted responses so clients back off
+	RetryPushbackFunc                  RetryPushbackFunc                      // returns the retry pushback per response, e.g. based on load, takes precedence over RetryPushback
+	AllowedContentSubtypes             []string                               // codecs requests may use, e.g. proto, others get InvalidArgument, all registered codecs are allowed when empty
+	MaxStreamMessages                  int                                    // max messages a handler can send on one server stream, further sends fail with ResourceExhausted, 0 means unlimited
+	MethodMaxStreamMessages            map[string]int                         // max stream messages by full method name, overriding MaxStreamMessages
+	FaultInjection                     *FaultConfig                           // inject latency and errors into requests for resilience testing, disabled when nil, never enable it in production
+	H2C                                bool                                   // serve plaintext http/2 behind an edge proxy that terminates tls, the proxy must send h2c with prior knowledge since upgrading from http/1.1 isn't supported
+	MemoryStoreMaxEntries              int                                    // max entries in each in-memory store the server creates for idempotency and the response cache, the least recently used are evicted, defaults to 10000
+	MemoryStoreMaxTTL                  time.Duration                          // caps how long entries live in the in-memory stores the server creates, 0 means no cap
+	StateDumpSignal                    os.Signal                              // os signal that makes Run() log a snapshot of the server state, e.g. syscall.SIGUSR1, see DumpState
+	MethodConcurrencyLimits            map[string]int                         // max in flight requests by full method name, requests over a method's limit get ResourceExhausted
+	MethodConcurrencyQueueTimeout      time.Duration                          // how long requests over a method's concurrency limit wait in line for a slot before getting ResourceExhausted, 0 rejects them immediately
+	AuditedMethods                     []string                               // full method names of mutating methods that get an audit record per call
+	AuditSink                          AuditSink                              // receives audit records, defaults to logging them at info level
+	AuditActorFunc                     func(ctx context.Context) string       // returns the caller's identity for audit records from the context set by AuthFunc, defaults to the peer ip
+	TlsNextProtos                      []string                               // ALPN protocols advertised during tls handshakes on every listener in order of preference, must include h2 for grpc, defaults to h2
+	NumStreamWorkers                   uint32                                 // handle streams on a pool of this many reused goroutines instead of a new goroutine per stream, cuts goroutine churn for high qps services at the cost of idle workers, streams get a new goroutine while the chosen worker is busy, 0 disables the pool
+	DeadlineOverrunGuardEnabled        bool                                   // count handlers that overrun their deadline, unary calls that overran return DeadlineExceeded, the handler's context is canceled at the deadline
+	DebugHandlers                      map[string]http.Handler                // custom handlers by path served on the metrics port behind the same auth as the metrics, see RegisterDebugHandler
+	StrictMetadata                     bool                                   // reject requests carrying metadata keys outside AllowedMetadataKeys with InvalidArgument, grpc's own keys and the keys this server is configured to read are always allowed
+	AllowedMetadataKeys                []string                               // metadata keys requests may carry when StrictMetadata is enabled, e.g. authorization
+	FeatureFlagProvider                FeatureFlagProvider                    // loads feature flags that handlers read with FlagsFromContext, loaded at startup then refreshed in the background
+	FeatureFlagRefreshInterval         time.Duration                          // how often to reload feature flags from the provider, defaults to 30 seconds
+	PrefaceTimeout                     time.Duration                          // how long a new connection has to finish the tls handshake and send the http/2 preface before it's dropped, protects against slow clients holding connections open, defaults to grpc's 120 seconds
+	EnabledInterceptors                []string                               // names of interceptors registered with RegisterUnaryInterceptor or RegisterStreamInterceptor to add, in order, after the configured interceptors
 }
 
 // NewGrpcServer instantiates and initializes a new grpc server. It does not run the server.
 func NewGrpcServer(config GrpcServerConfig) (*GrpcServer, error) {
+	return NewGrpcServerWithContext(context.Background(), config)
+}
+
+// NewGrpcServerWithContext instantiates and initializes a new grpc server, returning an error if the context is done
+// before initialization finishes, e.g. while fetching the ocsp staple. It does not run the server, the context has no
+// effect once the server is created.
+func NewGrpcServerWithContext(ctx context.Context, config GrpcServerConfig) (*GrpcServer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	if config.GetErrorToReturn == nil {
-		// by default, return an internal server error
+		// by default, return an internal server error, unless the panic was a status with details which was clearly
+		// meant for the caller
 		config.GetErrorToReturn = func(err error) error {
+			if hasStatusDetails(err) {
+				return err
+			}
 			return status.Error(codes.Internal, "unexpected error handling request")
 		}
 	}
@@ -71,21 +233,147 @@ func NewGrpcServer(config GrpcServerConfig) (*GrpcServer, error) {
 			return config.SentryEnabled
 		}
 	}
+	if config.LogRequestBodiesMaxBytes == 0 {
+		config.LogRequestBodiesMaxBytes = defaultLogRequestBodiesMaxBytes
+	}
+	if config.ClientVersionMetadataKey == "" {
+		config.ClientVersionMetadataKey = defaultClientVersionMetadataKey
+	}
+	if config.GracefulStopTimeout == 0 {
+		config.GracefulStopTimeout = defaultGracefulStopTimeout
+	}
+	if config.PanicFingerprint == nil {
+		config.PanicFingerprint = defaultPanicFingerprint
+	}
+	if config.TlsOcspRefreshInterval == 0 {
+		config.TlsOcspRefreshInterval = defaultTlsOcspRefreshInterval
+	}
+	if config.IdempotencyTTL == 0 {
+		config.IdempotencyTTL = defaultIdempotencyTTL
+	}
+	if config.DependencyCheckInterval == 0 {
+		config.DependencyCheckInterval = defaultDependencyCheckInterval
+	}
+	if config.DrainFilePollInterval == 0 {
+		config.DrainFilePollInterval = defaultDrainFilePollInterval
+	}
+	if config.CacheControlMetadataKey == "" {
+		config.CacheControlMetadataKey = defaultCacheControlMetadataKey
+	}
+	if config.DisabledMethodCode == codes.OK {
+		config.DisabledMethodCode = defaultDisabledMethodCode
+	}
+	if config.ShutdownHookTimeout == 0 {
+		config.ShutdownHookTimeout = defaultShutdownHookTimeout
+	}
+	if config.ResourceLockTimeout == 0 {
+		config.ResourceLockTimeout = defaultResourceLockTimeout
+	}
+	if config.RequestIDMetadataKey == "" {
+		config.RequestIDMetadataKey = defaultRequestIDMetadataKey
+	}
+	if config.MemoryStoreMaxEntries == 0 {
+		config.MemoryStoreMaxEntries = defaultMemoryStoreMaxEntries
+	}
+	if len(config.TlsNextProtos) == 0 {
+		config.TlsNextProtos = []string{"h2"}
+	}
+	if config.FeatureFlagRefreshInterval == 0 {
+		config.FeatureFlagRefreshInterval = defaultFeatureFlagRefreshInterval
+	}
+	if config.TenantMaxCardinality == 0 {
+		config.TenantMaxCardinality = defaultTenantMaxCardinality
+	}
 	grpcServer := &GrpcServer{
-		Config: config,
+		Config:   config,
+		log:      newServerLog(config.ServiceName),
+		shutDown: make(chan struct{}),
+		runError: make(chan error),
 	}
-	err := grpcServer.initialize()
+	grpcServer.backgroundCtx, grpcServer.cancelBackground = context.WithCancel(context.Background())
+	err := grpcServer.initialize(ctx)
 	return grpcServer, err
 }
 
+// newServerLog returns the log entry used for all server logs, tagged with the service name if there is one
+func newServerLog(serviceName string) *logrus.Entry {
+	if serviceName == "" {
+		return logrus.NewEntry(logging.Log)
+	}
+	return logging.Log.WithField("service", serviceName)
+}
+
 // initialize() initializes the server with the config
-func (s *GrpcServer) initialize() error {
-	s.setUnaryInterceptorChain()
-	s.setStreamInterceptorChain()
-	err := s.maybeLoadTLSCredentials()
+func (s *GrpcServer) initialize(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// first so that everything holding the server's log entry captures through the server's sentry hub
+	if err := s.maybeInitSentry(); err != nil {
+		return err
+	}
+	s.maybeInitTenantTagger()
+	s.maybeInitExemplarRecorder()
+	s.maybeRegisterBuildInfo()
+	s.maybeRegisterHealthGauges()
+	if s.Config.PrometheusEnabled && s.Config.PrometheusEnableMessageSizes {
+		s.messageSizeRecorder = newMessageSizeRecorder(s.metricsNamespace())
+	}
+	s.authFunc.set(s.Config.AuthFunc)
+	if s.Config.PrometheusEnabled && !s.Config.DisableRecovery {
+		s.panicRecorder = newPanicRecorder(s.metricsNamespace())
+	}
+	if s.Config.PrometheusEnabled && s.Config.AuthFunc != nil {
+		s.authFailureRecorder = newAuthFailureRecorder(s.metricsNamespace())
+	}
+	if s.Config.MaxConcurrentRequests > 0 {
+		// shared by both chains so that unary calls and streams count against the same limit
+		s.concurrencyLimiter = newConcurrencyLimiter(s.Config.MaxConcurrentRequests)
+	}
+	if len(s.Config.MethodConcurrencyLimits) > 0 {
+		s.methodLimiter = newMethodConcurrencyLimiter(s.Config.MethodConcurrencyLimits, s.Config.MethodConcurrencyQueueTimeout)
+	}
+	if s.Config.FaultInjection != nil {
+		// shared by both chains so that one seeded random sequence decides which requests get faults
+		s.faultInjector = newFaultInjector(s.log, *s.Config.FaultInjection)
+	}
+	err := s.maybeInitClientVersionChecker()
 	if err != nil {
 		return err
 	}
+	s.enabledUnary, s.enabledStream, err = enabledInterceptors(s.Config.EnabledInterceptors)
+	if err != nil {
+		return err
+	}
+	err = s.maybeSetGzipLevel()
+	if err != nil {
+		return err
+	}
+	s.setInterceptorChains()
+	err = s.maybeLoadTLSCredentials()
+	if err != nil {
+		return err
+	}
+	err = s.maybeStapleOCSP(ctx)
+	if err != nil {
+		return err
+	}
+	s.maybeLoadFeatureFlags(ctx)
+	s.maybeSetKeepaliveParams()
+	if s.Config.PrefaceTimeout > 0 {
+		// grpc sets a deadline on new connections that it clears once the http/2 handshake is done
+		s.Config.Opts = append(s.Config.Opts, grpc.ConnectionTimeout(s.Config.PrefaceTimeout))
+	}
+	if s.Config.NumStreamWorkers > 0 {
+		s.Config.Opts = append(s.Config.Opts, grpc.NumStreamWorkers(s.Config.NumStreamWorkers))
+	}
+	// always installed for ActiveConnections and state dumps, the gauges are only registered when prometheus is enabled.
+	// prepended so that a stats handler in the configured options takes precedence, grpc only supports one.
+	s.activeGauges = newActiveGaugesHandler(s.metricsNamespace(), s.Config.PrometheusEnabled)
+	s.Config.Opts = append([]grpc.ServerOption{grpc.StatsHandler(s.activeGauges)}, s.Config.Opts...)
+	if s.Config.UnknownServiceHandler != nil {
+		s.Config.Opts = append(s.Config.Opts, grpc.UnknownServiceHandler(s.Config.UnknownServiceHandler))
+	}
 	// create grpc server with options
 	server := grpc.NewServer(s.Config.Opts...)
 
@@ -95,188 +383,309 @@ func (s *GrpcServer) initialize() error {
 		s.Config.HealthServer = NewHealthChecker()
 	}
 	grpc_health_v1.RegisterHealthServer(server, s.Config.HealthServer)
+	if s.Config.ReflectionEnabled {
+		reflection.Register(server)
+	}
+	if s.messageSizeRecorder != nil {
+		s.messageSizeRecorder.server = server
+	}
+	s.maybeStartDependencyChecks()
+	s.maybeWatchDrainFile()
 	s.Server = server
 	return nil
 }
 
 // Run runs the grpc server, call this after creating a server with NewGrpcServer()
-func (s *GrpcServer) Run() (err error) {
+func (s *GrpcServer) Run() error {
 	// listen for os signals
 	var osSignal = make(chan os.Signal, 1)
 	signal.Notify(osSignal, os.Interrupt)
-	wg.Add(1)
+	defer signal.Stop(osSignal)
+	if s.Config.StateDumpSignal != nil {
+		dumpSignal := make(chan os.Signal, 1)
+		signal.Notify(dumpSignal, s.Config.StateDumpSignal)
+		defer signal.Stop(dumpSignal)
+		s.dumpStateOnSignal(dumpSignal)
+	}
+	return s.serveUntil(osSignal)
+}
+
+// ServeUntilError runs the grpc server until a serve error, such as failing to bind the port, or until Stop() is
+// called. Unlike Run() it doesn't handle os signals, so it composes with other goroutines managed by errgroup and the
+// like. Returns the serve error, or nil if stopped.
+func (s *GrpcServer) ServeUntilError() error {
+	return s.serveUntil(nil)
+}
+
+// serveUntil runs the server until a serve error, an os signal, or Stop(), then shuts it down. A nil signal channel
+// never receives.
+func (s *GrpcServer) serveUntil(osSignal <-chan os.Signal) (err error) {
+	err = s.checkRegisteredServices()
+	if err != nil {
+		return
+	}
+	s.wg.Add(1)
 	// run the server
 	go s.run()
-	// wait for either error or os signal to terminate
+	s.startPendingJobs()
+	// wait for either error, os signal, or Stop() to terminate
 	select {
-	case runErr := <-runError:
+	case runErr := <-s.runError:
 		err = runErr
-		errorutils.LogOnErr(nil, "error running gRPC server", err)
+		errorutils.LogOnErr(s.log, "error running gRPC server", err)
 	case <-osSignal:
 		// nothing special on osSignal, just break the select
+	case <-s.shutDown:
+		// Stop() was called
 	}
 	// close shutdown to stop the server
-	close(shutDown)
+	s.closeShutDown()
 	// wait for shutdown
-	wg.Wait()
+	s.wg.Wait()
 	return
 }
 
-// maybeInitSentry initializes a sentry client if configured to do so
-func (s *GrpcServer) maybeInitSentry() {
-	if s.Config.SentryEnabled {
-		sentryutils.MaybeInitSentry(s.Config.SentryClientOptions, nil)
+// checkRegisteredServices warns when only the default health and reflection services are registered, since every
+// other call would return Unimplemented. Returns an error instead if FailIfNoServices is set.
+func (s *GrpcServer) checkRegisteredServices() error {
+	for name := range s.Server.GetServiceInfo() {
+		if name != healthServiceName && name != reflectionServiceName {
+			return nil
+		}
 	}
+	if s.Config.FailIfNoServices {
+		return errors.New("no services are registered on the gRPC server")
+	}
+	s.log.Warn("no services are registered on the gRPC server besides health, all other calls will return Unimplemented")
+	return nil
 }
 
-// servePrometheusMetrics serves prometheus metrics
-func (s *GrpcServer) servePrometheusMetrics() {
-	// register prometheus
+// newMetricsServer creates the http server for prometheus metrics
+func (s *GrpcServer) newMetricsServer() *http.Server {
+	// register prometheus, the grpc_prometheus metrics are registered once globally so this is safe for every server in
+	// the process
 	grpc_prometheus.Register(s.Server)
 	// Register Prometheus metrics handler.
-	http.Handle(s.Config.PrometheusPath, promhttp.Handler())
+	// scrapers get the OpenMetrics format, which is the only one with exemplars, when they ask for it in the Accept
+	// header, and the classic text format otherwise
+	handler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	}))
+	mux := http.NewServeMux()
+	mux.Handle(s.Config.PrometheusPath, s.metricsAuthHandler(handler))
+	if s.Config.LogLevelEndpointEnabled {
+		mux.Handle(logLevelPath, s.metricsAuthHandler(s.logLevelHandler()))
+	}
+	s.mountDebugHandlers(mux)
 	// enable latency histograms
 	if s.Config.PrometheusEnableLatencyHistograms {
 		grpc_prometheus.EnableHandlingTimeHistogram()
 	}
-	err := http.ListenAndServe(fmt.Sprintf(":%d", s.Config.PrometheusPort), nil)
-	errorutils.PanicOnErr(nil, "error serving prometheus metrics", err)
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.Config.PrometheusPort),
+		Handler: s.httpRecoveryHandler(mux),
+	}
 }
 
-//run is the internal run implementation
+// servePrometheusMetrics serves prometheus metrics until the server is shut down
+func (s *GrpcServer) servePrometheusMetrics(server *http.Server) {
+	var err error
+	if s.Config.PrometheusTlsEnabled {
+		server.TLSConfig, err = s.metricsTLSConfig()
+		errorutils.PanicOnErr(s.log, "error loading prometheus metrics tls config", err)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		// shut down as part of the server shutdown sequence
+		return
+	}
+	errorutils.PanicOnErr(s.log, "error serving prometheus metrics", err)
+}
+
+// run is the internal run implementation
 func (s *GrpcServer) run() {
-	defer wg.Done()
-	s.maybeInitSentry()
+	defer s.wg.Done()
+	s.logEffectiveConfig()
 	// create listener
 	listenOn := fmt.Sprintf("0.0.0.0:%d", s.Config.Port)
-	listener, err := net.Listen("tcp", listenOn)
-	errorutils.LogOnErr(nil, "error creating grpc listener", err)
+	listenConfig := s.listenConfig()
+	listener, err := listenConfig.Listen(context.Background(), "tcp", listenOn)
+	if err != nil {
+		s.sendRunError(fmt.Errorf("error creating grpc listener: %w", err))
+		<-s.shutDown
+		s.shutdown()
+		return
+	}
+	if s.Config.ProxyProtocol {
+		// wrap the listener so that connections report the client address from the PROXY protocol header
+		listener = &proxyproto.Listener{Listener: listener}
+	}
+	if s.Config.H2C {
+		s.log.WithField("listening_on", listenOn).Info("serving h2c, tls is expected to be terminated by the edge proxy")
+	}
 
 	if s.Config.PrometheusEnabled {
-		go s.servePrometheusMetrics()
+		s.metricsServer = s.newMetricsServer()
+		go s.servePrometheusMetrics(s.metricsServer)
+	}
+
+	if s.Config.GrpcWebEnabled {
+		s.grpcWebServer = s.newGrpcWebServer()
+		go s.serveGrpcWeb(s.grpcWebServer)
+	}
+
+	if s.certificateHolder != nil && s.Config.TlsOcspResponseURL != "" {
+		go s.refreshOCSPStaplePeriodically()
 	}
 
 	// serve
 	go func() {
-		logging.Log.WithField("listening_on", listenOn).Info("gRPC server started")
-		runError <- s.Server.Serve(listener)
+		s.log.WithField("listening_on", listenOn).Info("gRPC server started")
+		s.sendRunError(s.Server.Serve(listener))
 	}()
+	s.serveAdditionalListeners()
+
+	<-s.shutDown
+	s.shutdown()
+}
+
+// logEffectiveConfig logs the effective configuration at debug level to help verify what's actually running
+func (s *GrpcServer) logEffectiveConfig() {
+	s.log.WithFields(s.effectiveConfigFields()).Debug("effective gRPC server config")
+}
 
-	<-shutDown
-	s.Server.Stop()
+// effectiveConfigFields returns the effective configuration as log fields. Secrets are redacted.
+func (s *GrpcServer) effectiveConfigFields() logrus.Fields {
+	sentryDsn := ""
+	if s.Config.SentryClientOptions.Dsn != "" {
+		sentryDsn = redactedValue
+	}
+	return logrus.Fields{
+		"port":                     s.Config.Port,
+		"tls_enabled":              s.certificateHolder != nil,
+		"min_tls_version":          s.Config.MinTlsVersion,
+		"sentry_enabled":           s.Config.SentryEnabled,
+		"sentry_dsn":               sentryDsn,
+		"prometheus_enabled":       s.Config.PrometheusEnabled,
+		"prometheus_port":          s.Config.PrometheusPort,
+		"prometheus_path":          s.Config.PrometheusPath,
+		"prometheus_tls_enabled":   s.Config.PrometheusTlsEnabled,
+		"auth_enabled":             s.authFunc.get() != nil,
+		"unary_interceptors":       len(s.Config.UnaryServerInterceptors),
+		"stream_interceptors":      len(s.Config.StreamServerInterceptors),
+		"server_options":           len(s.Config.Opts),
+		"max_connection_age":       s.Config.MaxConnectionAge,
+		"max_connection_age_grace": s.Config.MaxConnectionAgeGrace,
+		"proxy_protocol":           s.Config.ProxyProtocol,
+		"additional_listeners":     len(s.Config.AdditionalListeners),
+		"log_request_bodies":       s.Config.LogRequestBodies,
+		"grpc_web_enabled":         s.Config.GrpcWebEnabled,
+		"grpc_web_port":            s.Config.GrpcWebPort,
+		"max_concurrent_requests":  s.Config.MaxConcurrentRequests,
+		"h2c":                      s.Config.H2C,
+		"num_stream_workers":       s.Config.NumStreamWorkers,
+	}
+}
+
+// sendRunError reports a serve error to Run, unless the server is already shutting down
+func (s *GrpcServer) sendRunError(err error) {
+	select {
+	case s.runError <- err:
+	case <-s.shutDown:
+	}
 }
 
 // MaybeLoadTLSCredentials loads TLS transport credentials into the server options if the tls cert path, key path, and
-// ca path are specified.
+// ca path are specified, or if a PKCS#12 bundle path is specified. The credentials also handshake connections from
+// additional listeners with each listener's own tls settings, and call the OnConnection hook after every handshake.
 func (s *GrpcServer) maybeLoadTLSCredentials() error {
-	if s.Config.TlsCertPath != "" && s.Config.TlsKeyPath != "" && s.Config.TlsCaPath != "" {
+	var primary credentials.TransportCredentials
+	if s.tlsEnabled() {
 		if s.Config.MinTlsVersion == 0 {
 			s.Config.MinTlsVersion = tls.VersionTLS10
 		}
-		logging.Log.WithFields(logrus.Fields{
+		s.log.WithFields(logrus.Fields{
 			"min_tls_version": s.Config.MinTlsVersion,
 			"cert_path":       s.Config.TlsCertPath,
 			"key_path":        s.Config.TlsKeyPath,
 			"ca_path":         s.Config.TlsCaPath,
+			"pkcs12_path":     s.Config.TlsPkcs12Path,
 		}).Info("running with tls enabled")
-		srv, err := tls.LoadX509KeyPair(s.Config.TlsCertPath, s.Config.TlsKeyPath)
+		srv, chain, err := s.loadServerCertificate()
 		if err != nil {
 			return err
 		}
 
-		p := x509.NewCertPool()
-
-		if s.Config.TlsCaPath != "" {
-			ca, err := ioutil.ReadFile(s.Config.TlsCaPath)
-			if err != nil {
-				return err
-			}
+		s.certificateHolder = &certificateHolder{}
+		s.certificateHolder.setCertificate(&srv)
 
-			p.AppendCertsFromPEM(ca)
+		p, err := loadCertPool(s.Config.TlsCaPath, chain)
+		if err != nil {
+			return err
 		}
-		creds := grpc.Creds(credentials.NewTLS(&tls.Config{
-			MinVersion:   s.Config.MinTlsVersion,
-			Certificates: []tls.Certificate{srv},
-			RootCAs:      p,
-		}))
 
-		s.Config.Opts = append(s.Config.Opts, creds)
+		tlsConfig := &tls.Config{
+			MinVersion:     s.Config.MinTlsVersion,
+			GetCertificate: s.certificateHolder.getCertificate,
+			RootCAs:        p,
+			NextProtos:     s.Config.TlsNextProtos,
+		}
+		s.maybeConfigureSessionTickets(tlsConfig)
+		primary = credentials.NewTLS(tlsConfig)
+	}
+	anyListenerTLS := false
+	for _, listenerConfig := range s.Config.AdditionalListeners {
+		anyListenerTLS = anyListenerTLS || listenerConfig.tlsEnabled()
+	}
+	if primary == nil && len(s.Config.AdditionalListeners) == 0 && s.Config.OnConnection == nil {
+		return nil
 	}
+	// grpc credentials apply to every listener, so they pick the credentials of the listener each connection was
+	// accepted on
+	var creds credentials.TransportCredentials = &listenerCredentials{primary: primary, onConnection: s.Config.OnConnection}
+	if primary != nil || anyListenerTLS {
+		creds = newHandshakeObservingCredentials(creds, s.log, s.metricsNamespace(), s.Config.PrometheusEnabled)
+	}
+	s.Config.Opts = append(s.Config.Opts, grpc.Creds(creds))
 	return nil
 }
 
-func (s *GrpcServer) setUnaryInterceptorChain() {
-	recoverOpts := []grpc_recovery.Option{
-		grpc_recovery.WithRecoveryHandler(func(p interface{}) (err error) {
-			recoveredErr := errorutils.RecoverErr(p)
-			err = s.Config.GetErrorToReturn(recoveredErr)
-			if s.Config.CaptureRecoveredErr(err) {
-				errorutils.LogOnErr(nil, s.Config.CaptureErrormessage, err)
-			}
-			return
-		}),
-	}
-	// add default interceptors
-	interceptorChain := grpc_middleware.ChainUnaryServer(
-		grpc_prometheus.UnaryServerInterceptor,
-		grpc_recovery.UnaryServerInterceptor(recoverOpts...),
-	)
-	// add auth interceptor if we need to
-	if s.Config.AuthFunc != nil {
-		interceptorChain = grpc_middleware.ChainUnaryServer(
-			interceptorChain,
-			grpc_auth.UnaryServerInterceptor(s.Config.AuthFunc),
-		)
-	}
-	// add any additional interceptors
-	for _, interceptor := range s.Config.UnaryServerInterceptors {
-		interceptorChain = grpc_middleware.ChainUnaryServer(
-			interceptorChain,
-			interceptor,
-		)
-	}
-	unaryInterceptorOpt := grpc.UnaryInterceptor(
-		grpc_middleware.ChainUnaryServer(
-			interceptorChain,
-		),
-	)
-	s.Config.Opts = append(s.Config.Opts, unaryInterceptorOpt)
+// maybeSetKeepaliveParams sets keepalive server parameters if a max connection age is configured. Forcing clients to
+// periodically reconnect lets load balancers spread connections across new replicas.
+func (s *GrpcServer) maybeSetKeepaliveParams() {
+	if s.Config.MaxConnectionAge > 0 || s.Config.MaxConnectionAgeGrace > 0 {
+		s.log.WithFields(logrus.Fields{
+			"max_connection_age":       s.Config.MaxConnectionAge,
+			"max_connection_age_grace": s.Config.MaxConnectionAgeGrace,
+		}).Info("setting max connection age")
+		params := keepalive.ServerParameters{
+			MaxConnectionAge:      s.Config.MaxConnectionAge,
+			MaxConnectionAgeGrace: s.Config.MaxConnectionAgeGrace,
+		}
+		s.Config.Opts = append(s.Config.Opts, grpc.KeepaliveParams(params))
+	}
 }
 
-func (s *GrpcServer) setStreamInterceptorChain() {
-	recoverOpts := []grpc_recovery.Option{
-		grpc_recovery.WithRecoveryHandler(func(p interface{}) (err error) {
-			recoveredErr := errorutils.RecoverErr(p)
-			err = s.Config.GetErrorToReturn(recoveredErr)
-			if s.Config.CaptureRecoveredErr(err) {
-				errorutils.LogOnErr(nil, s.Config.CaptureErrormessage, err)
-			}
-			return
-		}),
-	}
-	// add default interceptors
-	interceptorChain := grpc_middleware.ChainStreamServer(
-		grpc_prometheus.StreamServerInterceptor,
-		grpc_recovery.StreamServerInterceptor(recoverOpts...),
-	)
-	// add auth interceptor if we need to
-	if s.Config.AuthFunc != nil {
-		interceptorChain = grpc_middleware.ChainStreamServer(
-			interceptorChain,
-			grpc_auth.StreamServerInterceptor(s.Config.AuthFunc),
-		)
-	}
-	// add any additional interceptors
-	for _, interceptor := range s.Config.StreamServerInterceptors {
-		interceptorChain = grpc_middleware.ChainStreamServer(
-			interceptorChain,
-			interceptor,
-		)
-	}
-	streamInterceptorOpt := grpc.StreamInterceptor(
-		grpc_middleware.ChainStreamServer(
-			interceptorChain,
-		),
-	)
-	s.Config.Opts = append(s.Config.Opts, streamInterceptorOpt)
+// maybeInitExemplarRecorder creates the exemplar recorder if prometheus exemplars are enabled
+func (s *GrpcServer) maybeInitExemplarRecorder() {
+	if s.Config.PrometheusEnabled && s.Config.PrometheusEnableExemplars && s.exemplarRecorder == nil {
+		s.exemplarRecorder = newExemplarRecorder(s.metricsNamespace(), s.Config.ExemplarTraceIDFromContext)
+	}
+}
+
+// maybeInitClientVersionChecker creates the client version checker if a min client version is configured
+func (s *GrpcServer) maybeInitClientVersionChecker() (err error) {
+	if s.Config.MinClientVersion != "" {
+		s.clientVersionChecker, err = newClientVersionChecker(s.Config.MinClientVersion, s.Config.ClientVersionMetadataKey, s.Config.ClientVersionExemptMethods, s.Config.RejectMissingClientVersion)
+	}
+	return
+}
+
+// maybeInitTenantTagger creates the tenant tagger if a tenant metadata key is configured
+func (s *GrpcServer) maybeInitTenantTagger() {
+	if s.Config.TenantMetadataKey != "" && s.tenantTagger == nil {
+		s.tenantTagger = newTenantTagger(s.metricsNamespace(), s.Config.TenantMetadataKey, s.Config.TenantAllowlist, s.Config.TenantMaxCardinality)
+	}
 }
@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"net/http"
+)
+
+// newGrpcWebServer wraps the grpc server with grpc-web in an http server so browsers can call it directly
+func (s *GrpcServer) newGrpcWebServer() *http.Server {
+	wrapped := grpcweb.WrapServer(s.Server, s.grpcWebOpts()...)
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.Config.GrpcWebPort),
+		Handler: wrapped,
+	}
+}
+
+// serveGrpcWeb serves grpc-web over http/1.1 until the server is shut down
+func (s *GrpcServer) serveGrpcWeb(server *http.Server) {
+	s.log.WithField("listening_on", server.Addr).Info("gRPC-Web server started")
+	err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		s.sendRunError(err)
+	}
+}
+
+// grpcWebOpts returns the grpc-web options from the config
+func (s *GrpcServer) grpcWebOpts() []grpcweb.Option {
+	opts := []grpcweb.Option{
+		grpcweb.WithOriginFunc(s.grpcWebOriginAllowed),
+	}
+	if len(s.Config.GrpcWebAllowedHeaders) > 0 {
+		opts = append(opts, grpcweb.WithAllowedRequestHeaders(s.Config.GrpcWebAllowedHeaders))
+	}
+	if s.Config.GrpcWebWebsocketsEnabled {
+		// websockets aren't subject to cors, so check the origin of the upgrade request against the same allowed origins
+		opts = append(opts,
+			grpcweb.WithWebsockets(true),
+			grpcweb.WithWebsocketOriginFunc(func(req *http.Request) bool {
+				return s.grpcWebOriginAllowed(req.Header.Get("Origin"))
+			}),
+		)
+		if s.Config.GrpcWebWebsocketPingInterval > 0 {
+			opts = append(opts, grpcweb.WithWebsocketPingInterval(s.Config.GrpcWebWebsocketPingInterval))
+		}
+	}
+	return opts
+}
+
+// grpcWebOriginAllowed returns true if the cors origin is allowed, "*" allows every origin
+func (s *GrpcServer) grpcWebOriginAllowed(origin string) bool {
+	for _, allowed := range s.Config.GrpcWebAllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -2,23 +2,82 @@ package pkg
 
 import (
 	"context"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sync"
 )
 
-type HealthChecker struct{}
+// healthServiceName is the name the health service is registered under
+const healthServiceName = "grpc.health.v1.Health"
+
+type HealthChecker struct {
+	lock     sync.RWMutex
+	status   grpc_health_v1.HealthCheckResponse_ServingStatus
+	services map[string]grpc_health_v1.HealthCheckResponse_ServingStatus
+}
 
 func NewHealthChecker() *HealthChecker {
-	return &HealthChecker{}
+	return &HealthChecker{
+		status:   grpc_health_v1.HealthCheckResponse_SERVING,
+		services: map[string]grpc_health_v1.HealthCheckResponse_ServingStatus{},
+	}
 }
 
 func (s *HealthChecker) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	servingStatus, ok := s.getServiceStatus(req.Service)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+	}
 	return &grpc_health_v1.HealthCheckResponse{
-		Status: grpc_health_v1.HealthCheckResponse_SERVING,
+		Status: servingStatus,
 	}, nil
 }
 
 func (s *HealthChecker) Watch(req *grpc_health_v1.HealthCheckRequest, server grpc_health_v1.Health_WatchServer) error {
+	servingStatus, ok := s.getServiceStatus(req.Service)
+	if !ok {
+		servingStatus = grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN
+	}
 	return server.Send(&grpc_health_v1.HealthCheckResponse{
-		Status: grpc_health_v1.HealthCheckResponse_SERVING,
+		Status: servingStatus,
 	})
 }
+
+// SetServingStatus sets the status returned by health checks
+func (s *HealthChecker) SetServingStatus(status grpc_health_v1.HealthCheckResponse_ServingStatus) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status = status
+}
+
+// SetServiceServingStatus sets the status of a named service. The overall status is NOT_SERVING while any named
+// service is NOT_SERVING.
+func (s *HealthChecker) SetServiceServingStatus(service string, status grpc_health_v1.HealthCheckResponse_ServingStatus) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.services[service] = status
+}
+
+func (s *HealthChecker) getStatus() grpc_health_v1.HealthCheckResponse_ServingStatus {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, serviceStatus := range s.services {
+		if serviceStatus == grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+			return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return s.status
+}
+
+// getServiceStatus returns the status of the named service, or the overall status for the empty name. Returns false
+// for unknown services.
+func (s *HealthChecker) getServiceStatus(service string) (grpc_health_v1.HealthCheckResponse_ServingStatus, bool) {
+	if service == "" {
+		return s.getStatus(), true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	serviceStatus, ok := s.services[service]
+	return serviceStatus, ok
+}
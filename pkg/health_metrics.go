@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"strconv"
+)
+
+// maybeRegisterHealthGauges registers grpc_server_ready and grpc_server_live gauges. They're evaluated on every scrape
+// so they always match what health checks report, including warmup tasks, dependency checks, maintenance mode, and
+// custom health servers. They're labelled with the service name and port so that each server in the process reports
+// its own state.
+func (s *GrpcServer) maybeRegisterHealthGauges() {
+	if !s.Config.PrometheusEnabled {
+		return
+	}
+	labels := prometheus.Labels{"service": s.Config.ServiceName, "port": strconv.Itoa(s.Config.Port)}
+	ready := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   s.metricsNamespace(),
+		Name:        "grpc_server_ready",
+		Help:        "1 if the server is ready to serve requests, i.e. its overall health status is SERVING and it isn't shutting down, otherwise 0.",
+		ConstLabels: labels,
+	}, func() float64 {
+		return boolGaugeValue(!s.isShuttingDown() && s.healthStatus() == grpc_health_v1.HealthCheckResponse_SERVING)
+	})
+	if !s.registerHealthGauge(ready) {
+		return
+	}
+	s.registerHealthGauge(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   s.metricsNamespace(),
+		Name:        "grpc_server_live",
+		Help:        "1 until the server starts shutting down, then 0.",
+		ConstLabels: labels,
+	}, func() float64 {
+		return boolGaugeValue(!s.isShuttingDown())
+	}))
+}
+
+// registerHealthGauge registers a health gauge, returning whether it was registered. Unlike other collectors an existing
+// one can't be shared, it would report another server's state, so that's logged instead.
+func (s *GrpcServer) registerHealthGauge(gauge prometheus.GaugeFunc) bool {
+	err := prometheus.Register(gauge)
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		s.log.WithField("port", s.Config.Port).Warn("another server with the same service name and port registered health gauges, they report that server's state")
+		return false
+	}
+	errorutils.LogOnErr(s.log, "error registering prometheus collector, its metrics will not be exported", err)
+	return err == nil
+}
+
+// healthStatus returns the overall status reported by the health server, UNKNOWN if there is no health server or the
+// check fails
+func (s *GrpcServer) healthStatus() grpc_health_v1.HealthCheckResponse_ServingStatus {
+	if s.Config.HealthServer == nil {
+		return grpc_health_v1.HealthCheckResponse_UNKNOWN
+	}
+	response, err := s.Config.HealthServer.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return grpc_health_v1.HealthCheckResponse_UNKNOWN
+	}
+	return response.Status
+}
+
+func boolGaugeValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
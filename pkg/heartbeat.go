@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"google.golang.org/grpc"
+	"sync"
+	"time"
+)
+
+// HeartbeatServerStream wraps a server stream to send a heartbeat message whenever nothing has been sent for the
+// interval, keeping idle streams alive behind proxies that time them out. Send through the wrapper so heartbeats are
+// serialized with data messages, and call Stop when the handler is done.
+type HeartbeatServerStream struct {
+	grpc.ServerStream
+	interval  time.Duration
+	heartbeat func() interface{}
+	sendLock  sync.Mutex
+	lastSend  time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// NewHeartbeatServerStream wraps the stream and starts sending heartbeats. heartbeat returns the message to send, it
+// must be of the stream's response type.
+func NewHeartbeatServerStream(stream grpc.ServerStream, interval time.Duration, heartbeat func() interface{}) *HeartbeatServerStream {
+	s := &HeartbeatServerStream{
+		ServerStream: stream,
+		interval:     interval,
+		heartbeat:    heartbeat,
+		lastSend:     time.Now(),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// SendMsg sends the message and resets the idle timer
+func (s *HeartbeatServerStream) SendMsg(m interface{}) error {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	s.lastSend = time.Now()
+	return s.ServerStream.SendMsg(m)
+}
+
+// Stop stops sending heartbeats and waits for any in progress heartbeat to finish
+func (s *HeartbeatServerStream) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+// run sends heartbeats until stopped or the stream ends
+func (s *HeartbeatServerStream) run() {
+	defer close(s.done)
+	timer := time.NewTimer(s.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			timer.Reset(s.maybeSendHeartbeat())
+		case <-s.stop:
+			return
+		case <-s.Context().Done():
+			return
+		}
+	}
+}
+
+// maybeSendHeartbeat sends a heartbeat if the stream has been idle for the interval, and returns how long to wait
+// before checking again
+func (s *HeartbeatServerStream) maybeSendHeartbeat() time.Duration {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	idle := time.Since(s.lastSend)
+	if idle < s.interval {
+		return s.interval - idle
+	}
+	s.lastSend = time.Now()
+	// errors are ignored, if the stream is broken the handler sees the error on its next send
+	_ = s.ServerStream.SendMsg(s.heartbeat())
+	return s.interval
+}
@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"strconv"
+	"time"
+)
+
+const defaultIdempotencyTTL = 10 * time.Minute
+
+// IdempotencyStore stores responses of completed requests by idempotency key
+type IdempotencyStore interface {
+	// Get returns the stored response for the key, and whether there was one
+	Get(key string) (interface{}, bool)
+	// Set stores the response for the key for the given ttl
+	Set(key string, response interface{}, ttl time.Duration)
+}
+
+// NewMemoryIdempotencyStore creates an in-memory idempotency store with no limits, which is only shared within a single
+// process, see NewMemoryIdempotencyStoreWithLimits
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return NewMemoryIdempotencyStoreWithLimits(MemoryStoreLimits{})
+}
+
+// NewMemoryIdempotencyStoreWithLimits creates an in-memory idempotency store that evicts the least recently used
+// responses past the max entries and caps how long responses are stored at the max ttl
+func NewMemoryIdempotencyStoreWithLimits(limits MemoryStoreLimits) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		lru: newLRUStore(limits),
+	}
+}
+
+type MemoryIdempotencyStore struct {
+	lru *lruStore
+}
+
+func (m *MemoryIdempotencyStore) Get(key string) (interface{}, bool) {
+	return m.lru.get(key)
+}
+
+func (m *MemoryIdempotencyStore) Set(key string, response interface{}, ttl time.Duration) {
+	m.lru.set(key, response, ttl)
+}
+
+// NewStateStoreIdempotencyStore creates an idempotency store backed by a state store, so idempotency can be shared
+// across replicas. Responses must be protos, they're stored serialized along with their type name. Store errors are
+// logged and treated as a miss.
+func NewStateStoreIdempotencyStore(store StateStore, log *logrus.Entry) *StateStoreIdempotencyStore {
+	return &StateStoreIdempotencyStore{
+		store: store,
+		log:   log,
+	}
+}
+
+type StateStoreIdempotencyStore struct {
+	store StateStore
+	log   *logrus.Entry
+}
+
+func (s *StateStoreIdempotencyStore) Get(key string) (interface{}, bool) {
+	value, ok, err := s.store.Get(context.Background(), key)
+	if err != nil {
+		s.log.WithError(err).Warn("error getting idempotency record")
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	message, err := unmarshalStoredMessage(value)
+	if err != nil {
+		s.log.WithError(err).Warn("error unmarshalling idempotency record")
+		return nil, false
+	}
+	return message, true
+}
+
+func (s *StateStoreIdempotencyStore) Set(key string, response interface{}, ttl time.Duration) {
+	message, ok := response.(proto.Message)
+	if !ok {
+		return
+	}
+	value, err := marshalStoredMessage(message)
+	if err != nil {
+		s.log.WithError(err).Warn("error marshalling idempotency record")
+		return
+	}
+	if err = s.store.Set(context.Background(), key, value, ttl); err != nil {
+		s.log.WithError(err).Warn("error setting idempotency record")
+	}
+}
+
+// idempotencyHandler returns the stored response for requests that repeat an idempotency key instead of re-executing
+// the handler. Only successful responses are stored so that failed requests can be retried. Keys are scoped to the
+// caller so clients can't read each other's responses, and concurrent requests with the same key run the handler once.
+type idempotencyHandler struct {
+	metadataKey string
+	ttl         time.Duration
+	store       IdempotencyStore
+	scopeFunc   func(ctx context.Context) string
+	inflight    singleflight.Group
+}
+
+func newIdempotencyHandler(metadataKey string, ttl time.Duration, store IdempotencyStore, scopeFunc func(ctx context.Context) string) *idempotencyHandler {
+	if store == nil {
+		store = NewMemoryIdempotencyStore()
+	}
+	if scopeFunc == nil {
+		scopeFunc = defaultIdempotencyScope
+	}
+	return &idempotencyHandler{
+		metadataKey: metadataKey,
+		ttl:         ttl,
+		store:       store,
+		scopeFunc:   scopeFunc,
+	}
+}
+
+func (h *idempotencyHandler) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	key := h.key(ctx, info.FullMethod)
+	if key == "" {
+		return handler(ctx, req)
+	}
+	// requests in flight are only deduplicated within this process, the store dedupes them once they complete. A panic
+	// skips storing the response, so the key is free to be retried once the call completes.
+	return doShared(&h.inflight, key, func() (interface{}, error) {
+		if response, ok := h.store.Get(key); ok {
+			return response, nil
+		}
+		// the first caller's context is used, so its cancellation affects everyone waiting on the result
+		resp, err := handler(ctx, req)
+		if err == nil {
+			h.store.Set(key, resp, h.ttl)
+		}
+		return resp, err
+	})
+}
+
+// key returns the store key for the request, scoped by method and caller so keys can't collide across methods or
+// clients. Returns an empty string if the request has no idempotency key.
+func (h *idempotencyHandler) key(ctx context.Context, method string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(h.metadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return ""
+	}
+	// quoted so a scope containing the separator can't collide with another scope and key
+	return method + ":" + strconv.Quote(h.scopeFunc(ctx)) + ":" + values[0]
+}
+
+// defaultIdempotencyScope scopes idempotency keys to the tenant, or to the peer ip for requests without a tenant
+func defaultIdempotencyScope(ctx context.Context) string {
+	if tenant, ok := TenantFromContext(ctx); ok {
+		return "tenant:" + tenant
+	}
+	return "peer:" + PeerIP(ctx)
+}
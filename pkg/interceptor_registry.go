@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"fmt"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// interceptorRegistry holds interceptors registered by name, usually from init functions, so that services can enable
+// them through EnabledInterceptors
+var interceptorRegistry = struct {
+	lock   sync.RWMutex
+	unary  map[string]grpc.UnaryServerInterceptor
+	stream map[string]grpc.StreamServerInterceptor
+}{
+	unary:  map[string]grpc.UnaryServerInterceptor{},
+	stream: map[string]grpc.StreamServerInterceptor{},
+}
+
+// registeredUnaryInterceptor is an enabled registered unary interceptor and the name it was registered with
+type registeredUnaryInterceptor struct {
+	name        string
+	interceptor grpc.UnaryServerInterceptor
+}
+
+// registeredStreamInterceptor is an enabled registered stream interceptor and the name it was registered with
+type registeredStreamInterceptor struct {
+	name        string
+	interceptor grpc.StreamServerInterceptor
+}
+
+// RegisterUnaryInterceptor registers a unary interceptor by name, it's added to servers that list the name in
+// EnabledInterceptors. Registering the same name again replaces the interceptor.
+func RegisterUnaryInterceptor(name string, interceptor grpc.UnaryServerInterceptor) {
+	interceptorRegistry.lock.Lock()
+	defer interceptorRegistry.lock.Unlock()
+	interceptorRegistry.unary[name] = interceptor
+}
+
+// RegisterStreamInterceptor registers a stream interceptor by name, it's added to servers that list the name in
+// EnabledInterceptors. Registering the same name again replaces the interceptor.
+func RegisterStreamInterceptor(name string, interceptor grpc.StreamServerInterceptor) {
+	interceptorRegistry.lock.Lock()
+	defer interceptorRegistry.lock.Unlock()
+	interceptorRegistry.stream[name] = interceptor
+}
+
+// enabledInterceptors looks up the enabled interceptors in order. A name only needs to be registered as one of unary
+// or stream, names registered as neither are an error.
+func enabledInterceptors(names []string) ([]registeredUnaryInterceptor, []registeredStreamInterceptor, error) {
+	interceptorRegistry.lock.RLock()
+	defer interceptorRegistry.lock.RUnlock()
+	unary := []registeredUnaryInterceptor{}
+	stream := []registeredStreamInterceptor{}
+	for _, name := range names {
+		unaryInterceptor, unaryOk := interceptorRegistry.unary[name]
+		streamInterceptor, streamOk := interceptorRegistry.stream[name]
+		// registering nil is the same as not registering, rather than a panic on the first request
+		unaryOk = unaryOk && unaryInterceptor != nil
+		streamOk = streamOk && streamInterceptor != nil
+		if !unaryOk && !streamOk {
+			return nil, nil, fmt.Errorf("no interceptor registered with name %q", name)
+		}
+		if unaryOk {
+			unary = append(unary, registeredUnaryInterceptor{name: name, interceptor: unaryInterceptor})
+		}
+		if streamOk {
+			stream = append(stream, registeredStreamInterceptor{name: name, interceptor: streamInterceptor})
+		}
+	}
+	return unary, stream, nil
+}
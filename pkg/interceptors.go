@@ -0,0 +1,662 @@
+package pkg
+
+import (
+	"context"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/grpc-ecosystem/go-grpc-prometheus"
+	"google.golang.org/grpc"
+	"runtime"
+)
+
+// UnaryInterceptor returns the assembled unary interceptor chain, useful for driving the chain directly in tests
+// without a network
+func (s *GrpcServer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return s.unaryInterceptor
+}
+
+// StreamInterceptor returns the assembled stream interceptor chain, useful for driving the chain directly in tests
+// without a network
+func (s *GrpcServer) StreamInterceptor() grpc.StreamServerInterceptor {
+	return s.streamInterceptor
+}
+
+// UnaryInterceptorNames returns the names of the interceptors in the unary chain, outermost first. Built in
+// interceptors have fixed names like recovery, prometheus, and auth, UnaryServerInterceptors are named custom, and
+// registered interceptors have the name they were registered with.
+func (s *GrpcServer) UnaryInterceptorNames() []string {
+	return append([]string{}, s.unaryNames...)
+}
+
+// StreamInterceptorNames returns the names of the interceptors in the stream chain, outermost first, named the same
+// way as UnaryInterceptorNames
+func (s *GrpcServer) StreamInterceptorNames() []string {
+	return append([]string{}, s.streamNames...)
+}
+
+// setInterceptorChains assembles the interceptor chains and adds them to the server options
+func (s *GrpcServer) setInterceptorChains() {
+	s.unaryInterceptor, s.unaryNames = s.getUnaryInterceptorChain()
+	s.streamInterceptor, s.streamNames = s.getStreamInterceptorChain()
+	s.Config.Opts = append(s.Config.Opts, grpc.UnaryInterceptor(s.unaryInterceptor), grpc.StreamInterceptor(s.streamInterceptor))
+}
+
+// recoveryHandler is called when recovering from a panic, it counts the panic, returns the error to return to the
+// caller, and captures the error if configured to do so
+func (s *GrpcServer) recoveryHandler(ctx context.Context, p interface{}) (err error) {
+	stack := panicStack()
+	report := true
+	if shared, ok := p.(*sharedPanic); ok {
+		// re-panicked by every caller sharing a singleflight call, handle the handler's panic and only report it once
+		p, stack, report = shared.value, shared.stack, shared.claimReport()
+	}
+	if s.panicRecorder != nil && report {
+		s.panicRecorder.record(ctx)
+	}
+	if s.Config.GetErrorToReturnFromPanic != nil {
+		err = s.Config.GetErrorToReturnFromPanic(p)
+	} else {
+		err = s.Config.GetErrorToReturn(errorutils.RecoverErr(p))
+	}
+	if report {
+		s.maybeCaptureRecoveredErr(ctx, p, stack, err)
+	}
+	return
+}
+
+// maybeCaptureRecoveredErr logs the error recovered from a panic, which captures it in sentry, if configured to do so.
+// The stack is the panicking stack, from panicStack, that the error is fingerprinted by.
+func (s *GrpcServer) maybeCaptureRecoveredErr(ctx context.Context, p interface{}, stack []runtime.Frame, err error) {
+	if s.Config.CaptureRecoveredErr(err) {
+		fingerprinted := &fingerprintedError{error: err, fingerprint: s.Config.PanicFingerprint(p, stack)}
+		errorutils.LogOnErr(s.logWithTenantHub(ctx), s.Config.CaptureErrormessage, fingerprinted)
+	}
+}
+
+// ctxTagsOpts returns the grpc_ctxtags options from the config
+func (s *GrpcServer) ctxTagsOpts() []grpc_ctxtags.Option {
+	opts := []grpc_ctxtags.Option{}
+	if s.Config.CtxTagsFieldExtractor != nil {
+		opts = append(opts, grpc_ctxtags.WithFieldExtractor(s.Config.CtxTagsFieldExtractor))
+	}
+	return opts
+}
+
+// getUnaryInterceptorChain assembles the unary interceptor chain from the config, returning it with the names of the
+// interceptors in it, outermost first
+func (s *GrpcServer) getUnaryInterceptorChain() (grpc.UnaryServerInterceptor, []string) {
+	// add default interceptors, recovery unless it's disabled
+	interceptorChain := grpc_middleware.ChainUnaryServer()
+	names := []string{}
+	if !s.Config.DisableRecovery {
+		names = append(names, "recovery")
+		recoverOpts := []grpc_recovery.Option{
+			grpc_recovery.WithRecoveryHandlerContext(s.recoveryHandler),
+		}
+		interceptorChain = grpc_recovery.UnaryServerInterceptor(recoverOpts...)
+	}
+	// add error correlation interceptor if we need to, outside recovery so the errors returned for recovered panics are
+	// correlated too, along with anything that rejects the call
+	if s.Config.ErrorCorrelationEnabled {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			newErrorCorrelator(s.log, s.Config.RequestIDMetadataKey).unaryInterceptor,
+			interceptorChain,
+		)
+		names = append([]string{"error_correlation"}, names...)
+	}
+	// add prometheus interceptor if we need to, it has per call overhead so skip it when nobody scrapes the metrics
+	if s.Config.PrometheusEnabled {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			grpc_prometheus.UnaryServerInterceptor,
+			interceptorChain,
+		)
+		names = append([]string{"prometheus"}, names...)
+	}
+	// add ctx tags interceptor right inside recovery so every later interceptor can log the tags
+	if s.Config.CtxTagsEnabled {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			grpc_ctxtags.UnaryServerInterceptor(s.ctxTagsOpts()...),
+		)
+		names = append(names, "ctxtags")
+	}
+	// add retry pushback interceptor if we need to, before anything that can reject the call with Unavailable
+	if pushback := s.retryPushbackFunc(); pushback != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newRetryPushback(pushback).unaryInterceptor,
+		)
+		names = append(names, "retry_pushback")
+	}
+	// add response headers interceptor if we need to, before anything that can reject the call so rejections carry
+	// the headers too
+	if len(s.Config.ResponseHeaders) > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newResponseHeaders(s.Config.ResponseHeaders).unaryInterceptor,
+		)
+		names = append(names, "response_headers")
+	}
+	// reject requests while in maintenance mode
+	interceptorChain = grpc_middleware.ChainUnaryServer(
+		interceptorChain,
+		s.maintenanceUnaryInterceptor,
+	)
+	names = append(names, "maintenance")
+	// reject methods disabled at runtime
+	interceptorChain = grpc_middleware.ChainUnaryServer(
+		interceptorChain,
+		s.disabledMethodUnaryInterceptor,
+	)
+	names = append(names, "disabled_methods")
+	// add content subtype interceptor if we need to
+	if len(s.Config.AllowedContentSubtypes) > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newContentSubtypeChecker(s.Config.AllowedContentSubtypes).unaryInterceptor,
+		)
+		names = append(names, "content_subtype")
+	}
+	// add metadata size interceptor if we need to
+	if s.Config.MaxMetadataBytes > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newMetadataSizeLimiter(s.metricsNamespace(), s.Config.MaxMetadataBytes).unaryInterceptor,
+		)
+		names = append(names, "metadata_size")
+	}
+	// add strict metadata interceptor if we need to
+	if s.Config.StrictMetadata {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.newMetadataAllowlist().unaryInterceptor,
+		)
+		names = append(names, "strict_metadata")
+	}
+	// add context logger interceptor if we need to
+	if s.Config.ContextLoggerEnabled {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newContextLogger(s.log, s.Config.RequestIDMetadataKey).unaryInterceptor,
+		)
+		names = append(names, "context_logger")
+	}
+	// add feature flag interceptor if we need to
+	if s.Config.FeatureFlagProvider != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.featureFlags.unaryInterceptor,
+		)
+		names = append(names, "feature_flags")
+	}
+	// add deadline budget interceptor if we need to
+	if s.deadlineBudgetEnabled() {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newDeadlineBudgetReducer(s.Config.DeadlineBudget, s.Config.MethodDeadlineBudgets).unaryInterceptor,
+		)
+		names = append(names, "deadline_budget")
+	}
+	// add concurrency limit interceptor if we need to
+	if s.concurrencyLimiter != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.concurrencyLimiter.unaryInterceptor,
+		)
+		names = append(names, "concurrency_limit")
+	}
+	// add method concurrency limit interceptor if we need to
+	if len(s.Config.MethodConcurrencyLimits) > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.methodLimiter.unaryInterceptor,
+		)
+		names = append(names, "method_concurrency_limit")
+	}
+	// add canceled status interceptor if we need to
+	if s.Config.NormalizeCanceledStatus {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newCanceledNormalizer(s.metricsNamespace()).unaryInterceptor,
+		)
+		names = append(names, "canceled_status")
+	}
+	// add client version interceptor if we need to
+	if s.clientVersionChecker != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.clientVersionChecker.unaryInterceptor,
+		)
+		names = append(names, "client_version")
+	}
+	// add auth interceptor if we need to
+	if s.Config.AuthFunc != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			grpc_auth.UnaryServerInterceptor(s.getAuthFunc()),
+		)
+		names = append(names, "auth")
+	}
+	// add audit interceptor if we need to, after auth so the actor can be read from the auth context
+	if len(s.Config.AuditedMethods) > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newAuditor(s.log, s.Config.AuditedMethods, s.Config.AuditSink, s.Config.AuditActorFunc, s.Config.LogRequestBodiesRedactedFields).unaryInterceptor,
+		)
+		names = append(names, "audit")
+	}
+	// add server timing interceptor if we need to, after auth so only authorized callers see timings
+	if s.Config.EmitServerTimingTrailers {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			serverTimingUnaryInterceptor,
+		)
+		names = append(names, "server_timing")
+	}
+	// add tenant interceptor if we need to
+	if s.tenantTagger != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.tenantTagger.unaryInterceptor,
+		)
+		names = append(names, "tenant")
+	}
+	// add forbidden fields interceptor if we need to
+	if len(s.Config.ForbiddenFields) > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newForbiddenFieldsChecker(s.Config.ForbiddenFields).unaryInterceptor,
+		)
+		names = append(names, "forbidden_fields")
+	}
+	// add message size interceptor if we need to
+	if s.messageSizeRecorder != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.messageSizeRecorder.unaryInterceptor,
+		)
+		names = append(names, "message_sizes")
+	}
+	// add fault injection interceptor if we need to
+	if s.faultInjector != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.faultInjector.unaryInterceptor,
+		)
+		names = append(names, "fault_injection")
+	}
+	// add body logging interceptor if we need to
+	if s.Config.LogRequestBodies {
+		bodyLogger := newBodyLogger(s.log, s.Config.LogRequestBodiesRedactedFields, s.Config.LogRequestBodiesMaxBytes)
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			bodyLogger.unaryInterceptor,
+		)
+		names = append(names, "body_logging")
+	}
+	// add idempotency interceptor if we need to
+	if s.Config.IdempotencyMetadataKey != "" {
+		idempotencyStore := s.Config.IdempotencyStore
+		if idempotencyStore == nil && s.Config.StateStore != nil {
+			idempotencyStore = NewStateStoreIdempotencyStore(s.Config.StateStore, s.log)
+		}
+		if idempotencyStore == nil {
+			idempotencyStore = s.newMemoryIdempotencyStore()
+		}
+		idempotencyHandler := newIdempotencyHandler(s.Config.IdempotencyMetadataKey, s.Config.IdempotencyTTL, idempotencyStore, s.Config.IdempotencyScopeFunc)
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			idempotencyHandler.unaryInterceptor,
+		)
+		names = append(names, "idempotency")
+	}
+	// add resource lock interceptor if we need to
+	if s.Config.ResourceLockKey != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newResourceLocker(s.Config.ResourceLockKey, s.Config.ResourceLockTimeout).unaryInterceptor,
+		)
+		names = append(names, "resource_lock")
+	}
+	// add response cache interceptor if we need to
+	if len(s.Config.CachedMethods) > 0 {
+		cacheStore := s.Config.StateStore
+		if cacheStore == nil {
+			cacheStore = s.newMemoryStateStore("response_cache")
+		}
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newResponseCache(s.Config.CachedMethods, s.Config.CacheControlMetadataKey, cacheStore, s.log).unaryInterceptor,
+		)
+		names = append(names, "response_cache")
+	}
+	// add request coalescing interceptor if we need to
+	if len(s.Config.CoalescedMethods) > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newRequestCoalescer(s.Config.CoalescedMethods).unaryInterceptor,
+		)
+		names = append(names, "request_coalescing")
+	}
+	// add deadline overrun interceptor if we need to
+	if s.Config.DeadlineOverrunGuardEnabled {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newDeadlineOverrunGuard(s.metricsNamespace()).unaryInterceptor,
+		)
+		names = append(names, "deadline_overrun")
+	}
+	// add goroutine leak interceptor if we need to
+	if s.Config.GoroutineLeakThreshold > 0 {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			newGoroutineLeakDetector(s.log, s.metricsNamespace(), s.Config.GoroutineLeakThreshold).unaryInterceptor,
+		)
+		names = append(names, "goroutine_leaks")
+	}
+	// add any additional interceptors
+	for _, interceptor := range s.Config.UnaryServerInterceptors {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			interceptor,
+		)
+		names = append(names, "custom")
+	}
+	// add any enabled registered interceptors
+	for _, registered := range s.enabledUnary {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			registered.interceptor,
+		)
+		names = append(names, registered.name)
+	}
+	// add exemplar interceptor last so it observes spans started by any earlier interceptor
+	if s.exemplarRecorder != nil {
+		interceptorChain = grpc_middleware.ChainUnaryServer(
+			interceptorChain,
+			s.exemplarRecorder.unaryInterceptor,
+		)
+		names = append(names, "exemplars")
+	}
+	return interceptorChain, names
+}
+
+// getStreamInterceptorChain assembles the stream interceptor chain from the config, returning it with the names of the
+// interceptors in it, outermost first
+func (s *GrpcServer) getStreamInterceptorChain() (grpc.StreamServerInterceptor, []string) {
+	// add default interceptors, recovery unless it's disabled
+	interceptorChain := grpc_middleware.ChainStreamServer()
+	names := []string{}
+	if !s.Config.DisableRecovery {
+		names = append(names, "recovery")
+		recoverOpts := []grpc_recovery.Option{
+			grpc_recovery.WithRecoveryHandlerContext(s.recoveryHandler),
+		}
+		interceptorChain = grpc_recovery.StreamServerInterceptor(recoverOpts...)
+	}
+	// add error correlation interceptor if we need to, outside recovery so the errors returned for recovered panics are
+	// correlated too, along with anything that rejects the call
+	if s.Config.ErrorCorrelationEnabled {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			newErrorCorrelator(s.log, s.Config.RequestIDMetadataKey).streamInterceptor,
+			interceptorChain,
+		)
+		names = append([]string{"error_correlation"}, names...)
+	}
+	// add prometheus interceptor if we need to, it has per call overhead so skip it when nobody scrapes the metrics
+	if s.Config.PrometheusEnabled {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			grpc_prometheus.StreamServerInterceptor,
+			interceptorChain,
+		)
+		names = append([]string{"prometheus"}, names...)
+	}
+	// add ctx tags interceptor right inside recovery so every later interceptor can log the tags
+	if s.Config.CtxTagsEnabled {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			grpc_ctxtags.StreamServerInterceptor(s.ctxTagsOpts()...),
+		)
+		names = append(names, "ctxtags")
+	}
+	// add retry pushback interceptor if we need to, before anything that can reject the call with Unavailable
+	if pushback := s.retryPushbackFunc(); pushback != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newRetryPushback(pushback).streamInterceptor,
+		)
+		names = append(names, "retry_pushback")
+	}
+	// add response headers interceptor if we need to, before anything that can reject the call so rejections carry
+	// the headers too
+	if len(s.Config.ResponseHeaders) > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newResponseHeaders(s.Config.ResponseHeaders).streamInterceptor,
+		)
+		names = append(names, "response_headers")
+	}
+	// end streams that are active during shutdown with a clean status
+	interceptorChain = grpc_middleware.ChainStreamServer(
+		interceptorChain,
+		s.shutdownStreamInterceptor,
+	)
+	names = append(names, "shutdown")
+	// reject requests while in maintenance mode
+	interceptorChain = grpc_middleware.ChainStreamServer(
+		interceptorChain,
+		s.maintenanceStreamInterceptor,
+	)
+	names = append(names, "maintenance")
+	// reject methods disabled at runtime
+	interceptorChain = grpc_middleware.ChainStreamServer(
+		interceptorChain,
+		s.disabledMethodStreamInterceptor,
+	)
+	names = append(names, "disabled_methods")
+	// add content subtype interceptor if we need to
+	if len(s.Config.AllowedContentSubtypes) > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newContentSubtypeChecker(s.Config.AllowedContentSubtypes).streamInterceptor,
+		)
+		names = append(names, "content_subtype")
+	}
+	// add metadata size interceptor if we need to
+	if s.Config.MaxMetadataBytes > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newMetadataSizeLimiter(s.metricsNamespace(), s.Config.MaxMetadataBytes).streamInterceptor,
+		)
+		names = append(names, "metadata_size")
+	}
+	// hide filtered services from reflection if we need to
+	if s.Config.ReflectionEnabled && s.Config.ReflectionServiceFilter != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.reflectionFilterStreamInterceptor,
+		)
+		names = append(names, "reflection_filter")
+	}
+	// add strict metadata interceptor if we need to
+	if s.Config.StrictMetadata {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.newMetadataAllowlist().streamInterceptor,
+		)
+		names = append(names, "strict_metadata")
+	}
+	// add context logger interceptor if we need to
+	if s.Config.ContextLoggerEnabled {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newContextLogger(s.log, s.Config.RequestIDMetadataKey).streamInterceptor,
+		)
+		names = append(names, "context_logger")
+	}
+	// add feature flag interceptor if we need to
+	if s.Config.FeatureFlagProvider != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.featureFlags.streamInterceptor,
+		)
+		names = append(names, "feature_flags")
+	}
+	// add deadline budget interceptor if we need to
+	if s.deadlineBudgetEnabled() {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newDeadlineBudgetReducer(s.Config.DeadlineBudget, s.Config.MethodDeadlineBudgets).streamInterceptor,
+		)
+		names = append(names, "deadline_budget")
+	}
+	// add concurrency limit interceptor if we need to
+	if s.concurrencyLimiter != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.concurrencyLimiter.streamInterceptor,
+		)
+		names = append(names, "concurrency_limit")
+	}
+	// add method concurrency limit interceptor if we need to
+	if len(s.Config.MethodConcurrencyLimits) > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.methodLimiter.streamInterceptor,
+		)
+		names = append(names, "method_concurrency_limit")
+	}
+	// add canceled status interceptor if we need to
+	if s.Config.NormalizeCanceledStatus {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newCanceledNormalizer(s.metricsNamespace()).streamInterceptor,
+		)
+		names = append(names, "canceled_status")
+	}
+	// add client version interceptor if we need to
+	if s.clientVersionChecker != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.clientVersionChecker.streamInterceptor,
+		)
+		names = append(names, "client_version")
+	}
+	// add auth interceptor if we need to
+	if s.Config.AuthFunc != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			grpc_auth.StreamServerInterceptor(s.getAuthFunc()),
+		)
+		names = append(names, "auth")
+	}
+	// add audit interceptor if we need to, after auth so the actor can be read from the auth context
+	if len(s.Config.AuditedMethods) > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newAuditor(s.log, s.Config.AuditedMethods, s.Config.AuditSink, s.Config.AuditActorFunc, s.Config.LogRequestBodiesRedactedFields).streamInterceptor,
+		)
+		names = append(names, "audit")
+	}
+	// add server timing interceptor if we need to, after auth so only authorized callers see timings
+	if s.Config.EmitServerTimingTrailers {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			serverTimingStreamInterceptor,
+		)
+		names = append(names, "server_timing")
+	}
+	// add tenant interceptor if we need to
+	if s.tenantTagger != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.tenantTagger.streamInterceptor,
+		)
+		names = append(names, "tenant")
+	}
+	// add forbidden fields interceptor if we need to
+	if len(s.Config.ForbiddenFields) > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newForbiddenFieldsChecker(s.Config.ForbiddenFields).streamInterceptor,
+		)
+		names = append(names, "forbidden_fields")
+	}
+	// add message size interceptor if we need to
+	if s.messageSizeRecorder != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.messageSizeRecorder.streamInterceptor,
+		)
+		names = append(names, "message_sizes")
+	}
+	// add stream message limit interceptor if we need to
+	if s.Config.MaxStreamMessages > 0 || len(s.Config.MethodMaxStreamMessages) > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newStreamMessageLimiter(s.Config.MaxStreamMessages, s.Config.MethodMaxStreamMessages).streamInterceptor,
+		)
+		names = append(names, "stream_message_limit")
+	}
+	// add fault injection interceptor if we need to
+	if s.faultInjector != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.faultInjector.streamInterceptor,
+		)
+		names = append(names, "fault_injection")
+	}
+	// add body logging interceptor if we need to
+	if s.Config.LogRequestBodies {
+		bodyLogger := newBodyLogger(s.log, s.Config.LogRequestBodiesRedactedFields, s.Config.LogRequestBodiesMaxBytes)
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			bodyLogger.streamInterceptor,
+		)
+		names = append(names, "body_logging")
+	}
+	// add deadline overrun interceptor if we need to
+	if s.Config.DeadlineOverrunGuardEnabled {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newDeadlineOverrunGuard(s.metricsNamespace()).streamInterceptor,
+		)
+		names = append(names, "deadline_overrun")
+	}
+	// add goroutine leak interceptor if we need to
+	if s.Config.GoroutineLeakThreshold > 0 {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			newGoroutineLeakDetector(s.log, s.metricsNamespace(), s.Config.GoroutineLeakThreshold).streamInterceptor,
+		)
+		names = append(names, "goroutine_leaks")
+	}
+	// add any additional interceptors
+	for _, interceptor := range s.Config.StreamServerInterceptors {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			interceptor,
+		)
+		names = append(names, "custom")
+	}
+	// add any enabled registered interceptors
+	for _, registered := range s.enabledStream {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			registered.interceptor,
+		)
+		names = append(names, registered.name)
+	}
+	// add exemplar interceptor last so it observes spans started by any earlier interceptor
+	if s.exemplarRecorder != nil {
+		interceptorChain = grpc_middleware.ChainStreamServer(
+			interceptorChain,
+			s.exemplarRecorder.streamInterceptor,
+		)
+		names = append(names, "exemplars")
+	}
+	return interceptorChain, names
+}
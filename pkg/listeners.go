@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+	"net"
+)
+
+// ListenerConfig configures an additional listener that serves the same registered services as the primary port
+type ListenerConfig struct {
+	Address                            string // address to listen on, e.g. 127.0.0.1:6001
+	TlsCertPath, TlsKeyPath, TlsCaPath string // file paths to tls cert, key, and ca, if all 3 are provided then the listener serves tls, otherwise plaintext
+	MinTlsVersion                      uint16 // minimum tls version to use, defaults to 1.0
+}
+
+// tlsEnabled returns true if the listener is configured to serve tls
+func (c ListenerConfig) tlsEnabled() bool {
+	return c.TlsCertPath != "" && c.TlsKeyPath != "" && c.TlsCaPath != ""
+}
+
+// listen creates the listener. Its connections are tagged with the listener's transport credentials, nil for plaintext,
+// so the server's listenerCredentials handshake them with the listener's own tls settings, advertising the server's
+// ALPN protocols.
+func (c ListenerConfig) listen(listenConfig net.ListenConfig, nextProtos []string) (net.Listener, error) {
+	var creds credentials.TransportCredentials
+	if c.tlsEnabled() {
+		certificate, err := tls.LoadX509KeyPair(c.TlsCertPath, c.TlsKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := loadCertPool(c.TlsCaPath, nil)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(newListenerTLSConfig(pool, c.MinTlsVersion, nextProtos, func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &certificate, nil
+		}))
+	}
+	listener, err := listenConfig.Listen(context.Background(), "tcp", c.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &credentialedListener{Listener: listener, creds: creds}, nil
+}
+
+// newListenerTLSConfig creates the tls config for an additional listener's transport credentials
+func newListenerTLSConfig(pool *x509.CertPool, minVersion uint16, nextProtos []string, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS10
+	}
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: getCertificate,
+		RootCAs:        pool,
+		NextProtos:     nextProtos,
+	}
+}
+
+// credentialedListener tags accepted connections with the transport credentials of the listener they came from
+type credentialedListener struct {
+	net.Listener
+	creds credentials.TransportCredentials
+}
+
+func (l *credentialedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &credentialedConn{Conn: conn, creds: l.creds}, nil
+}
+
+// credentialedConn is a connection accepted by a credentialedListener
+type credentialedConn struct {
+	net.Conn
+	creds credentials.TransportCredentials
+}
+
+// listenerCredentials are the server's transport credentials. grpc only supports one set per server, so they handshake
+// each connection with the credentials of the listener it was accepted on, or the primary credentials for connections
+// from the primary listener. Every tls handshake going through grpc credentials means handshake failures are observed
+// and peers carry auth info on every listener. The OnConnection hook is called once the handshake is done.
+type listenerCredentials struct {
+	primary      credentials.TransportCredentials // nil when the primary listener is plaintext
+	onConnection func(net.Conn, *tls.ConnectionState)
+}
+
+func (c *listenerCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	creds := c.primary
+	if accepted, ok := rawConn.(*credentialedConn); ok {
+		creds, rawConn = accepted.creds, accepted.Conn
+	}
+	conn, authInfo := rawConn, credentials.AuthInfo(nil)
+	if creds != nil {
+		var err error
+		conn, authInfo, err = creds.ServerHandshake(rawConn)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if c.onConnection != nil {
+		var tlsState *tls.ConnectionState
+		if tlsInfo, ok := authInfo.(credentials.TLSInfo); ok {
+			tlsState = &tlsInfo.State
+		}
+		c.onConnection(conn, tlsState)
+	}
+	return conn, authInfo, nil
+}
+
+func (c *listenerCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("listener credentials only support server handshakes")
+}
+
+func (c *listenerCredentials) Info() credentials.ProtocolInfo {
+	if c.primary == nil {
+		return credentials.ProtocolInfo{SecurityProtocol: "insecure"}
+	}
+	return c.primary.Info()
+}
+
+func (c *listenerCredentials) Clone() credentials.TransportCredentials {
+	clone := *c
+	if c.primary != nil {
+		clone.primary = c.primary.Clone()
+	}
+	return &clone
+}
+
+func (c *listenerCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// serveAdditionalListeners serves the server on each additional listener
+func (s *GrpcServer) serveAdditionalListeners() {
+	for _, listenerConfig := range s.Config.AdditionalListeners {
+		listener, err := listenerConfig.listen(s.listenConfig(), s.Config.TlsNextProtos)
+		if err != nil {
+			s.sendRunError(err)
+			return
+		}
+		go func(listenerConfig ListenerConfig, listener net.Listener) {
+			s.log.WithFields(logrus.Fields{
+				"listening_on": listenerConfig.Address,
+				"tls":          listenerConfig.tlsEnabled(),
+			}).Info("gRPC additional listener started")
+			s.sendRunError(s.Server.Serve(listener))
+		}(listenerConfig, listener)
+	}
+}
@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const logLevelPath = "/loglevel"
+const maxLogLevelBodyBytes = 64
+
+// SetLogLevel sets the level of the server's logger. The logger is shared, so this changes the level for everything
+// logging through it in the process.
+func (s *GrpcServer) SetLogLevel(level logrus.Level) {
+	s.log.Logger.SetLevel(level)
+	s.log.WithField("level", level.String()).Info("set log level")
+}
+
+// logLevelHandler returns the current log level on GET, and sets it on PUT from a level name in the body like debug
+func (s *GrpcServer) logLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxLogLevelBodyBytes))
+			if err != nil {
+				http.Error(w, "error reading body", http.StatusBadRequest)
+				return
+			}
+			level, err := logrus.ParseLevel(strings.TrimSpace(string(body)))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.SetLogLevel(level)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprintln(w, s.log.Logger.GetLevel().String())
+	})
+}
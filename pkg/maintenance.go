@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync"
+)
+
+const defaultMaintenanceMessage = "server is in maintenance mode"
+
+// maintenanceMode is the state behind SetMaintenanceMode
+type maintenanceMode struct {
+	lock    sync.RWMutex
+	enabled bool
+	message string
+}
+
+func (m *maintenanceMode) get() (bool, string) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.enabled, m.message
+}
+
+func (m *maintenanceMode) set(enabled bool, message string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.enabled = enabled
+	m.message = message
+}
+
+// SetMaintenanceMode toggles maintenance mode. While enabled the port stays open and existing connections are kept, but
+// new RPCs are rejected with Unavailable and the message, and the default health server reports NOT_SERVING. Health
+// checks are never rejected. A custom HealthServer is not updated.
+func (s *GrpcServer) SetMaintenanceMode(enabled bool, message string) {
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	s.maintenanceMode.set(enabled, message)
+	if healthChecker, ok := s.Config.HealthServer.(*HealthChecker); ok {
+		if enabled {
+			healthChecker.SetServingStatus(grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+		} else {
+			healthChecker.SetServingStatus(grpc_health_v1.HealthCheckResponse_SERVING)
+		}
+	}
+	s.log.WithField("enabled", enabled).Info("set maintenance mode")
+}
+
+// maintenanceErr returns the error to reject the method with, or nil if it should be allowed
+func (s *GrpcServer) maintenanceErr(fullMethod string) error {
+	enabled, message := s.maintenanceMode.get()
+	if !enabled || strings.HasPrefix(fullMethod, "/"+healthServiceName+"/") {
+		return nil
+	}
+	return status.Error(codes.Unavailable, message)
+}
+
+func (s *GrpcServer) maintenanceUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.maintenanceErr(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *GrpcServer) maintenanceStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.maintenanceErr(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"container/list"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+const defaultMemoryStoreMaxEntries = 10000
+
+// MemoryStoreLimits bounds the memory used by an in-memory store
+type MemoryStoreLimits struct {
+	MaxEntries int           // max entries kept, the least recently used are evicted past it, 0 means unlimited
+	MaxTTL     time.Duration // caps how long entries live regardless of the ttl they're set with, 0 means no cap
+}
+
+// lruStore is the in-memory store behind MemoryStateStore and MemoryIdempotencyStore. Entries expire after their ttl,
+// and when there are more than the max entries the least recently used are evicted.
+type lruStore struct {
+	lock    sync.Mutex
+	limits  MemoryStoreLimits
+	entries map[string]*list.Element
+	order   *list.List // of *lruEntry, most recently used first
+	metrics *memoryStoreMetrics
+}
+
+type lruEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+func newLRUStore(limits MemoryStoreLimits) *lruStore {
+	return &lruStore{
+		limits:  limits,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the unexpired value for the key, counting a hit or a miss
+func (l *lruStore) get(key string) (interface{}, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	entry, ok := l.getEntry(key)
+	if !ok {
+		l.metrics.miss()
+		return nil, false
+	}
+	l.metrics.hit()
+	return entry.value, true
+}
+
+// set sets the value for the key, expiring after ttl or the max ttl, whichever is sooner
+func (l *lruStore) set(key string, value interface{}, ttl time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.setEntry(key, value, l.expiresAt(ttl))
+}
+
+// expiresAt returns when an entry set now with the ttl expires
+func (l *lruStore) expiresAt(ttl time.Duration) time.Time {
+	if l.limits.MaxTTL > 0 && ttl > l.limits.MaxTTL {
+		ttl = l.limits.MaxTTL
+	}
+	return time.Now().Add(ttl)
+}
+
+// getEntry returns the unexpired entry for the key and marks it as recently used, deleting it if it has expired. Must
+// be called with the lock held.
+func (l *lruStore) getEntry(key string) (*lruEntry, bool) {
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		l.order.Remove(element)
+		delete(l.entries, key)
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+	return entry, true
+}
+
+// setEntry sets the entry for the key and evicts the least recently used entries past the max. Must be called with the
+// lock held.
+func (l *lruStore) setEntry(key string, value interface{}, expiresAt time.Time) {
+	if element, ok := l.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.order.MoveToFront(element)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for l.limits.MaxEntries > 0 && l.order.Len() > l.limits.MaxEntries {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+		l.metrics.eviction()
+	}
+}
+
+// memoryStoreMetrics counts hits, misses, and evictions of one in-memory store
+type memoryStoreMetrics struct {
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	evictions prometheus.Counter
+}
+
+func newMemoryStoreMetrics(namespace, store string) *memoryStoreMetrics {
+	hits := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_memory_store_hits_total",
+		Help:      "Total number of lookups that found an unexpired entry in an in-memory store.",
+	}, []string{"store"})
+	misses := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_memory_store_misses_total",
+		Help:      "Total number of lookups that found no unexpired entry in an in-memory store.",
+	}, []string{"store"})
+	evictions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_memory_store_evictions_total",
+		Help:      "Total number of entries evicted from an in-memory store because it was full.",
+	}, []string{"store"})
+	return &memoryStoreMetrics{
+		hits:      registerCollector(hits).(*prometheus.CounterVec).WithLabelValues(store),
+		misses:    registerCollector(misses).(*prometheus.CounterVec).WithLabelValues(store),
+		evictions: registerCollector(evictions).(*prometheus.CounterVec).WithLabelValues(store),
+	}
+}
+
+// the methods are no-ops on nil so stores created outside the server don't need metrics
+
+func (m *memoryStoreMetrics) hit() {
+	if m != nil {
+		m.hits.Inc()
+	}
+}
+
+func (m *memoryStoreMetrics) miss() {
+	if m != nil {
+		m.misses.Inc()
+	}
+}
+
+func (m *memoryStoreMetrics) eviction() {
+	if m != nil {
+		m.evictions.Inc()
+	}
+}
+
+// memoryStoreLimits returns the limits for in-memory stores created by the server
+func (s *GrpcServer) memoryStoreLimits() MemoryStoreLimits {
+	return MemoryStoreLimits{
+		MaxEntries: s.Config.MemoryStoreMaxEntries,
+		MaxTTL:     s.Config.MemoryStoreMaxTTL,
+	}
+}
+
+// newMemoryStateStore creates a bounded in-memory state store with metrics labelled with the store name
+func (s *GrpcServer) newMemoryStateStore(name string) *MemoryStateStore {
+	store := NewMemoryStateStoreWithLimits(s.memoryStoreLimits())
+	store.lru.metrics = newMemoryStoreMetrics(s.metricsNamespace(), name)
+	return store
+}
+
+// newMemoryIdempotencyStore creates a bounded in-memory idempotency store with metrics
+func (s *GrpcServer) newMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	store := NewMemoryIdempotencyStoreWithLimits(s.memoryStoreLimits())
+	store.lru.metrics = newMemoryStoreMetrics(s.metricsNamespace(), "idempotency")
+	return store
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"sync"
+)
+
+const messageSizeMethodUnknown = "unknown"
+
+// messageSizeRecorder records the serialized size of request and response messages by method. Methods that aren't
+// registered on the server, e.g. calls handled by an UnknownServiceHandler, share one label to bound cardinality.
+type messageSizeRecorder struct {
+	server      *grpc.Server
+	sizes       *prometheus.HistogramVec
+	methodsOnce sync.Once
+	methods     map[string]bool
+}
+
+func newMessageSizeRecorder(namespace string) *messageSizeRecorder {
+	sizes := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_message_size_bytes",
+		Help:      "Histogram of serialized message sizes (bytes) of gRPC requests and responses handled by the server.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 10),
+	}, []string{"grpc_method", "direction"})
+	return &messageSizeRecorder{
+		sizes: registerCollector(sizes).(*prometheus.HistogramVec),
+	}
+}
+
+func (r *messageSizeRecorder) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := r.methodLabel(info.FullMethod)
+	r.observe(method, "request", req)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		r.observe(method, "response", resp)
+	}
+	return resp, err
+}
+
+func (r *messageSizeRecorder) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &messageSizeServerStream{ServerStream: ss, recorder: r, method: r.methodLabel(info.FullMethod)})
+}
+
+// observe records the size of the message if it's a proto
+func (r *messageSizeRecorder) observe(method, direction string, msg interface{}) {
+	if protoMsg, ok := msg.(proto.Message); ok {
+		r.sizes.WithLabelValues(method, direction).Observe(float64(proto.Size(protoMsg)))
+	}
+}
+
+// methodLabel returns the method if it's registered on the server, otherwise the unknown label. Services have to be
+// registered before the server starts, so the registered methods are read once on the first call.
+func (r *messageSizeRecorder) methodLabel(fullMethod string) string {
+	r.methodsOnce.Do(func() {
+		r.methods = map[string]bool{}
+		for service, info := range r.server.GetServiceInfo() {
+			for _, method := range info.Methods {
+				r.methods["/"+service+"/"+method.Name] = true
+			}
+		}
+	})
+	if r.methods[fullMethod] {
+		return fullMethod
+	}
+	return messageSizeMethodUnknown
+}
+
+// messageSizeServerStream wraps a server stream to record the size of every message sent and received
+type messageSizeServerStream struct {
+	grpc.ServerStream
+	recorder *messageSizeRecorder
+	method   string
+}
+
+func (s *messageSizeServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recorder.observe(s.method, "request", m)
+	}
+	return err
+}
+
+func (s *messageSizeServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.recorder.observe(s.method, "response", m)
+	}
+	return err
+}
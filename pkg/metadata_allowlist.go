@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sort"
+	"strings"
+)
+
+// alwaysAllowedMetadataKeys are set by grpc clients and proxies themselves, keys starting with : or grpc- are allowed
+// too
+var alwaysAllowedMetadataKeys = []string{"content-type", "user-agent", "te"}
+
+// metadataAllowlist rejects requests carrying metadata keys outside the allowlist with InvalidArgument, so that
+// headers can't be smuggled through to handlers or downstream services
+type metadataAllowlist struct {
+	allowed map[string]bool
+}
+
+func newMetadataAllowlist(keys ...[]string) *metadataAllowlist {
+	allowed := map[string]bool{}
+	for _, keyList := range keys {
+		for _, key := range keyList {
+			if key != "" {
+				// metadata keys are always lowercase on the server side
+				allowed[strings.ToLower(key)] = true
+			}
+		}
+	}
+	return &metadataAllowlist{
+		allowed: allowed,
+	}
+}
+
+func (a *metadataAllowlist) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.check(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *metadataAllowlist) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.check(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// check returns InvalidArgument naming the unexpected keys if there are any
+func (a *metadataAllowlist) check(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	unexpected := []string{}
+	for key := range md {
+		if !a.allowed[key] && !strings.HasPrefix(key, ":") && !strings.HasPrefix(key, "grpc-") {
+			unexpected = append(unexpected, key)
+		}
+	}
+	if len(unexpected) == 0 {
+		return nil
+	}
+	// sorted so the message is the same for the same request
+	sort.Strings(unexpected)
+	return status.Errorf(codes.InvalidArgument, "unexpected metadata keys: %s", strings.Join(unexpected, ", "))
+}
+
+// newMetadataAllowlist creates an allowlist of the configured keys plus the keys read by the enabled features
+func (s *GrpcServer) newMetadataAllowlist() *metadataAllowlist {
+	featureKeys := []string{s.Config.TenantMetadataKey, s.Config.IdempotencyMetadataKey}
+	if s.Config.ContextLoggerEnabled || s.Config.ErrorCorrelationEnabled {
+		featureKeys = append(featureKeys, s.Config.RequestIDMetadataKey)
+	}
+	if s.Config.MinClientVersion != "" {
+		featureKeys = append(featureKeys, s.Config.ClientVersionMetadataKey)
+	}
+	if len(s.Config.CachedMethods) > 0 {
+		featureKeys = append(featureKeys, s.Config.CacheControlMetadataKey)
+	}
+	return newMetadataAllowlist(alwaysAllowedMetadataKeys, s.Config.AllowedMetadataKeys, featureKeys)
+}
@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// headerFieldOverhead is the per field overhead http2 counts towards the header list size
+const headerFieldOverhead = 32
+
+// metadataSizeLimiter rejects requests with more metadata than the max with ResourceExhausted and an informative
+// message. Metadata over grpc's transport header list size limit is rejected before any interceptor runs with an
+// opaque error, so the max should be below that limit to be the one clients see.
+type metadataSizeLimiter struct {
+	maxBytes  int
+	oversized *prometheus.CounterVec
+}
+
+func newMetadataSizeLimiter(namespace string, maxBytes int) *metadataSizeLimiter {
+	oversized := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_oversized_metadata_total",
+		Help:      "Total number of RPCs rejected because their request metadata exceeded the max size.",
+	}, []string{"grpc_method"})
+	return &metadataSizeLimiter{
+		maxBytes:  maxBytes,
+		oversized: registerCollector(oversized).(*prometheus.CounterVec),
+	}
+}
+
+func (l *metadataSizeLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (l *metadataSizeLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// check returns ResourceExhausted if the request metadata is larger than the max, counted the way http2 counts the
+// header list size
+func (l *metadataSizeLimiter) check(ctx context.Context, method string) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	size := 0
+	for key, values := range md {
+		for _, value := range values {
+			size += len(key) + len(value) + headerFieldOverhead
+		}
+	}
+	if size <= l.maxBytes {
+		return nil
+	}
+	l.oversized.WithLabelValues(method).Inc()
+	return status.Errorf(codes.ResourceExhausted, "request metadata is %d bytes, which exceeds the max of %d bytes", size, l.maxBytes)
+}
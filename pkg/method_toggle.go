@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+)
+
+const defaultDisabledMethodCode = codes.Unimplemented
+
+// disabledMethods is the state behind SetMethodEnabled
+type disabledMethods struct {
+	lock    sync.RWMutex
+	methods map[string]bool
+}
+
+func (d *disabledMethods) disabled(fullMethod string) bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.methods[fullMethod]
+}
+
+func (d *disabledMethods) set(fullMethod string, enabled bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if enabled {
+		delete(d.methods, fullMethod)
+		return
+	}
+	if d.methods == nil {
+		d.methods = map[string]bool{}
+	}
+	d.methods[fullMethod] = true
+}
+
+// SetMethodEnabled enables or disables a method by full method name, e.g. /package.Service/Method. Disabled methods
+// are rejected with DisabledMethodCode while the rest of the service keeps serving. Methods are enabled by default.
+func (s *GrpcServer) SetMethodEnabled(fullMethod string, enabled bool) {
+	s.disabledMethods.set(fullMethod, enabled)
+	s.log.WithField("method", fullMethod).WithField("enabled", enabled).Info("set method enabled")
+}
+
+// disabledMethodErr returns the error to reject the method with, or nil if it's enabled
+func (s *GrpcServer) disabledMethodErr(fullMethod string) error {
+	if !s.disabledMethods.disabled(fullMethod) {
+		return nil
+	}
+	return status.Errorf(s.Config.DisabledMethodCode, "method %s is disabled", fullMethod)
+}
+
+func (s *GrpcServer) disabledMethodUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.disabledMethodErr(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *GrpcServer) disabledMethodStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.disabledMethodErr(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+	"github.com/catalystsquad/app-utils-go/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// registerCollector registers the collector on the default prometheus registry. If an equivalent collector is already
+// registered, the existing collector is returned so that several servers in one process share the same metrics. Any
+// other registration error, like a conflicting collector with the same name, is logged and the collector is returned
+// unregistered, so the server still works but the metric isn't exported.
+func registerCollector(collector prometheus.Collector) prometheus.Collector {
+	err := prometheus.Register(collector)
+	if err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			return alreadyRegistered.ExistingCollector
+		}
+		errorutils.LogOnErr(logrus.NewEntry(logging.Log), "error registering prometheus collector, its metrics will not be exported", err)
+	}
+	return collector
+}
+
+// metricsNamespace returns the namespace for metrics created by this package, the sanitized service name if
+// ServiceNameMetricsNamespace is set
+func (s *GrpcServer) metricsNamespace() string {
+	if !s.Config.ServiceNameMetricsNamespace {
+		return ""
+	}
+	return invalidMetricNameChars.ReplaceAllString(s.Config.ServiceName, "_")
+}
+
+// metricsAuthHandler wraps the metrics handler to require basic auth or a bearer token when configured
+func (s *GrpcServer) metricsAuthHandler(handler http.Handler) http.Handler {
+	basicAuthEnabled := s.Config.PrometheusBasicAuthUsername != "" && s.Config.PrometheusBasicAuthPassword != ""
+	bearerEnabled := s.Config.PrometheusBearerToken != ""
+	if !basicAuthEnabled && !bearerEnabled {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if basicAuthEnabled {
+			if username, password, ok := r.BasicAuth(); ok && secureEquals(username, s.Config.PrometheusBasicAuthUsername) && secureEquals(password, s.Config.PrometheusBasicAuthPassword) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		if bearerEnabled {
+			authorization := r.Header.Get("Authorization")
+			if strings.HasPrefix(authorization, "Bearer ") && secureEquals(strings.TrimPrefix(authorization, "Bearer "), s.Config.PrometheusBearerToken) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		if basicAuthEnabled {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// metricsTLSConfig returns the tls config for the metrics endpoint, using the metrics cert if configured, otherwise the
+// gRPC server certificate
+func (s *GrpcServer) metricsTLSConfig() (*tls.Config, error) {
+	if s.Config.PrometheusTlsCertPath != "" && s.Config.PrometheusTlsKeyPath != "" {
+		certificate, err := tls.LoadX509KeyPair(s.Config.PrometheusTlsCertPath, s.Config.PrometheusTlsKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			MinVersion:   s.Config.MinTlsVersion,
+			Certificates: []tls.Certificate{certificate},
+		}, nil
+	}
+	if s.certificateHolder == nil {
+		return nil, errors.New("prometheus tls is enabled but neither a metrics cert and key nor gRPC tls are configured")
+	}
+	return &tls.Config{
+		MinVersion:     s.Config.MinTlsVersion,
+		GetCertificate: s.certificateHolder.getCertificate,
+	}, nil
+}
+
+// secureEquals compares strings in constant time
+func secureEquals(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// httpRecoveryHandler recovers panics in http handlers, responding with a 500 and logging the error with its stack.
+// The error is captured the same way as panics in gRPC handlers, only if CaptureRecoveredErr says so. Aborted handlers
+// are re-panicked since net/http expects to handle those itself.
+func (s *GrpcServer) httpRecoveryHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				stack := panicStack()
+				err := errorutils.RecoverErr(p)
+				// without the sentry hub on the entry's context the log hook doesn't capture it
+				log := s.log.WithContext(context.Background())
+				if s.Config.CaptureRecoveredErr(err) {
+					log = s.logWithTenantHub(r.Context())
+					err = &fingerprintedError{error: err, fingerprint: s.Config.PanicFingerprint(p, stack)}
+				}
+				log.WithError(err).WithField("stack", formatStack(stack)).Errorf("recovered from panic serving %s %s", r.Method, r.URL.Path)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
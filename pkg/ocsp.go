@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const defaultTlsOcspRefreshInterval = time.Hour
+const maxOcspResponseBytes = 1 << 20
+
+// maybeStapleOCSP staples the configured static OCSP response, or fetches one from the configured url. The url is
+// expected to return a DER encoded OCSP response for the served certificate.
+func (s *GrpcServer) maybeStapleOCSP(ctx context.Context) error {
+	if s.certificateHolder == nil {
+		return nil
+	}
+	if len(s.Config.TlsOcspStaple) > 0 {
+		s.certificateHolder.setOCSPStaple(s.Config.TlsOcspStaple)
+	}
+	if s.Config.TlsOcspResponseURL != "" {
+		return s.refreshOCSPStaple(ctx)
+	}
+	return nil
+}
+
+// refreshOCSPStaple fetches the OCSP response from the configured url and staples it to the served certificate
+func (s *GrpcServer) refreshOCSPStaple(ctx context.Context) error {
+	client := http.Client{Timeout: 30 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Config.TlsOcspResponseURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status fetching ocsp response: %d", resp.StatusCode)
+	}
+	staple, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxOcspResponseBytes))
+	if err != nil {
+		return err
+	}
+	s.certificateHolder.setOCSPStaple(staple)
+	s.log.WithField("ocsp_response_url", s.Config.TlsOcspResponseURL).Debug("refreshed ocsp staple")
+	return nil
+}
+
+// refreshOCSPStaplePeriodically refreshes the OCSP staple on an interval until shutdown. On failure the previous staple
+// is kept, it remains valid until its own next update time.
+func (s *GrpcServer) refreshOCSPStaplePeriodically() {
+	ticker := time.NewTicker(s.Config.TlsOcspRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			errorutils.LogOnErr(s.log, "error refreshing ocsp staple", s.refreshOCSPStaple(s.backgroundCtx))
+		case <-s.shutDown:
+			return
+		}
+	}
+}
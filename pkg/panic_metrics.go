@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// panicRecorder counts panics recovered from handlers by method, for alerting on the panic rate
+type panicRecorder struct {
+	panics *prometheus.CounterVec
+}
+
+func newPanicRecorder(namespace string) *panicRecorder {
+	panics := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_panics_recovered_total",
+		Help:      "Total number of panics recovered from RPC handlers, by method.",
+	}, []string{"grpc_method"})
+	return &panicRecorder{
+		panics: registerCollector(panics).(*prometheus.CounterVec),
+	}
+}
+
+// record counts a recovered panic for the method of the request on the context
+func (r *panicRecorder) record(ctx context.Context) {
+	method, ok := grpc.Method(ctx)
+	if !ok {
+		method = "unknown"
+	}
+	r.panics.WithLabelValues(method).Inc()
+}
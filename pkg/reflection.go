@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"strings"
+)
+
+const reflectionServiceName = "grpc.reflection.v1alpha.ServerReflection"
+const reflectionMethod = "/" + reflectionServiceName + "/ServerReflectionInfo"
+
+// reflectionFilterStreamInterceptor hides services rejected by the reflection service filter from reflection. They're
+// dropped from service listings and from the file descriptors returned, and looking up their symbols returns
+// NOT_FOUND. Hidden services are still callable.
+func (s *GrpcServer) reflectionFilterStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if info.FullMethod != reflectionMethod {
+		return handler(srv, ss)
+	}
+	return handler(srv, &reflectionFilterServerStream{ServerStream: ss, server: s})
+}
+
+// reflectionFilterServerStream filters the responses of the reflection service
+type reflectionFilterServerStream struct {
+	grpc.ServerStream
+	server *GrpcServer
+}
+
+func (s *reflectionFilterServerStream) SendMsg(m interface{}) error {
+	if resp, ok := m.(*rpb.ServerReflectionResponse); ok {
+		s.filter(resp)
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// filter removes hidden services from the response in place
+func (s *reflectionFilterServerStream) filter(resp *rpb.ServerReflectionResponse) {
+	if symbol := resp.GetOriginalRequest().GetFileContainingSymbol(); symbol != "" && s.symbolHidden(symbol) {
+		resp.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
+			ErrorResponse: &rpb.ErrorResponse{
+				ErrorCode:    int32(codes.NotFound),
+				ErrorMessage: fmt.Sprintf("symbol not found: %s", symbol),
+			},
+		}
+		return
+	}
+	switch typed := resp.MessageResponse.(type) {
+	case *rpb.ServerReflectionResponse_ListServicesResponse:
+		services := []*rpb.ServiceResponse{}
+		for _, service := range typed.ListServicesResponse.GetService() {
+			if s.server.Config.ReflectionServiceFilter(service.Name) {
+				services = append(services, service)
+			}
+		}
+		typed.ListServicesResponse.Service = services
+	case *rpb.ServerReflectionResponse_FileDescriptorResponse:
+		for i, file := range typed.FileDescriptorResponse.GetFileDescriptorProto() {
+			typed.FileDescriptorResponse.FileDescriptorProto[i] = s.filterFile(file)
+		}
+	}
+}
+
+// filterFile removes hidden services from a serialized file descriptor
+func (s *reflectionFilterServerStream) filterFile(file []byte) []byte {
+	descriptor := &descriptorpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(file, descriptor); err != nil {
+		return file
+	}
+	services := []*descriptorpb.ServiceDescriptorProto{}
+	for _, service := range descriptor.Service {
+		name := service.GetName()
+		if descriptor.GetPackage() != "" {
+			name = descriptor.GetPackage() + "." + name
+		}
+		if s.server.Config.ReflectionServiceFilter(name) {
+			services = append(services, service)
+		}
+	}
+	if len(services) == len(descriptor.Service) {
+		return file
+	}
+	descriptor.Service = services
+	filtered, err := proto.Marshal(descriptor)
+	if err != nil {
+		return file
+	}
+	return filtered
+}
+
+// symbolHidden returns true if the symbol is a hidden service or one of its methods
+func (s *reflectionFilterServerStream) symbolHidden(symbol string) bool {
+	services := s.server.Server.GetServiceInfo()
+	if _, ok := services[symbol]; ok {
+		return !s.server.Config.ReflectionServiceFilter(symbol)
+	}
+	if i := strings.LastIndex(symbol, "."); i >= 0 {
+		if _, ok := services[symbol[:i]]; ok {
+			return !s.server.Config.ReflectionServiceFilter(symbol[:i])
+		}
+	}
+	return false
+}
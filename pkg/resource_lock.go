@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+const defaultResourceLockTimeout = 10 * time.Second
+
+// ResourceLockKeyFunc returns the resource key to serialize the request on, and false to run the request without a
+// lock, e.g. for read methods
+type ResourceLockKeyFunc func(ctx context.Context, fullMethod string, req interface{}) (string, bool)
+
+// resourceLocker serializes unary handlers per resource key within this process. Requests waiting longer than the
+// timeout get Aborted so clients can retry.
+type resourceLocker struct {
+	keyFunc ResourceLockKeyFunc
+	timeout time.Duration
+	lock    sync.Mutex
+	locks   map[string]*resourceLock
+}
+
+// resourceLock is a lock for one key, a channel so that acquiring it can time out
+type resourceLock struct {
+	semaphore chan struct{}
+	refs      int
+}
+
+func newResourceLocker(keyFunc ResourceLockKeyFunc, timeout time.Duration) *resourceLocker {
+	return &resourceLocker{
+		keyFunc: keyFunc,
+		timeout: timeout,
+		locks:   map[string]*resourceLock{},
+	}
+}
+
+func (l *resourceLocker) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	key, ok := l.keyFunc(ctx, info.FullMethod, req)
+	if !ok {
+		return handler(ctx, req)
+	}
+	lock := l.ref(key)
+	defer l.unref(key)
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case lock.semaphore <- struct{}{}:
+	case <-timer.C:
+		return nil, status.Errorf(codes.Aborted, "timed out waiting for another request on the same resource")
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	// deferred so the lock is released even if the handler panics
+	defer func() { <-lock.semaphore }()
+	return handler(ctx, req)
+}
+
+// ref returns the lock for the key, creating it if needed, and counts the reference so unused locks can be deleted
+func (l *resourceLocker) ref(key string) *resourceLock {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &resourceLock{semaphore: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// unref releases a reference to the key's lock, deleting it once nobody holds or waits for it
+func (l *resourceLocker) unref(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	lock := l.locks[key]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"strings"
+	"time"
+)
+
+const defaultCacheControlMetadataKey = "cache-control"
+const responseCacheKeyPrefix = "response-cache:"
+
+// responseCache caches successful responses of read methods by request, in the state store. Cache keys only include
+// the method and request, so methods whose responses depend on the caller must not be cached. Clients can send a
+// no-cache directive to skip reading from the cache, and a no-store directive to skip writing to it.
+type responseCache struct {
+	methodTTLs              map[string]time.Duration
+	cacheControlMetadataKey string
+	store                   StateStore
+	log                     *logrus.Entry
+}
+
+func newResponseCache(methodTTLs map[string]time.Duration, cacheControlMetadataKey string, store StateStore, log *logrus.Entry) *responseCache {
+	if store == nil {
+		store = NewMemoryStateStore()
+	}
+	return &responseCache{
+		methodTTLs:              methodTTLs,
+		cacheControlMetadataKey: cacheControlMetadataKey,
+		store:                   store,
+		log:                     log,
+	}
+}
+
+func (c *responseCache) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ttl, ok := c.methodTTLs[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	key, ok := c.key(info.FullMethod, req)
+	if !ok {
+		return handler(ctx, req)
+	}
+	noCache, noStore := c.cacheControl(ctx)
+	if !noCache {
+		if resp, ok := c.get(ctx, key); ok {
+			return resp, nil
+		}
+	}
+	resp, err := handler(ctx, req)
+	if err == nil && !noStore {
+		c.set(ctx, key, resp, ttl)
+	}
+	return resp, err
+}
+
+// key returns the cache key for the request, a hash of the deterministically marshalled request scoped by method.
+// Returns false if the request can't be keyed.
+func (c *responseCache) key(method string, req interface{}) (string, bool) {
+	protoReq, ok := req.(proto.Message)
+	if !ok {
+		return "", false
+	}
+	serialized, err := proto.MarshalOptions{Deterministic: true}.Marshal(protoReq)
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.Sum256(serialized)
+	return responseCacheKeyPrefix + method + ":" + hex.EncodeToString(hash[:]), true
+}
+
+// cacheControl returns whether the client sent the no-cache and no-store directives
+func (c *responseCache) cacheControl(ctx context.Context) (noCache bool, noStore bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return
+	}
+	for _, value := range md.Get(c.cacheControlMetadataKey) {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-cache":
+				noCache = true
+			case "no-store":
+				noStore = true
+			}
+		}
+	}
+	return
+}
+
+// get returns the cached response, store errors are logged and treated as a miss
+func (c *responseCache) get(ctx context.Context, key string) (interface{}, bool) {
+	value, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.log.WithError(err).Warn("error getting cached response")
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	resp, err := unmarshalStoredMessage(value)
+	if err != nil {
+		c.log.WithError(err).Warn("error unmarshalling cached response")
+		return nil, false
+	}
+	return resp, true
+}
+
+// set caches the response, store errors are logged
+func (c *responseCache) set(ctx context.Context, key string, resp interface{}, ttl time.Duration) {
+	protoResp, ok := resp.(proto.Message)
+	if !ok {
+		return
+	}
+	value, err := marshalStoredMessage(protoResp)
+	if err != nil {
+		c.log.WithError(err).Warn("error marshalling response to cache")
+		return
+	}
+	if err = c.store.Set(ctx, key, value, ttl); err != nil {
+		c.log.WithError(err).Warn("error caching response")
+	}
+}
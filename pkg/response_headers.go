@@ -0,0 +1,29 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// responseHeaders sets the same headers on every response
+type responseHeaders struct {
+	headers metadata.MD
+}
+
+func newResponseHeaders(headers metadata.MD) *responseHeaders {
+	return &responseHeaders{
+		headers: headers,
+	}
+}
+
+func (h *responseHeaders) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	// headers are best effort, failing to set them shouldn't fail the call
+	_ = grpc.SetHeader(ctx, h.headers.Copy())
+	return handler(ctx, req)
+}
+
+func (h *responseHeaders) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	_ = ss.SetHeader(h.headers.Copy())
+	return handler(srv, ss)
+}
@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"time"
+)
+
+const retryPushbackTrailer = "grpc-retry-pushback-ms"
+
+// RetryPushbackFunc returns how long clients should wait before retrying a call that failed with the code, e.g. based
+// on current load
+type RetryPushbackFunc func(ctx context.Context, code codes.Code) time.Duration
+
+// retryPushback sets the grpc-retry-pushback-ms trailer on Unavailable and ResourceExhausted responses, which clients
+// with a retry policy honor to back off
+type retryPushback struct {
+	pushback RetryPushbackFunc
+}
+
+func newRetryPushback(pushback RetryPushbackFunc) *retryPushback {
+	return &retryPushback{
+		pushback: pushback,
+	}
+}
+
+func (p *retryPushback) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if trailer, ok := p.trailer(ctx, err); ok {
+		// trailers are best effort, failing to set one shouldn't change the error
+		_ = grpc.SetTrailer(ctx, trailer)
+	}
+	return resp, err
+}
+
+func (p *retryPushback) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	if trailer, ok := p.trailer(ss.Context(), err); ok {
+		ss.SetTrailer(trailer)
+	}
+	return err
+}
+
+// trailer returns the pushback trailer for the error, and false if the error isn't retryable with pushback
+func (p *retryPushback) trailer(ctx context.Context, err error) (metadata.MD, bool) {
+	code := status.Code(err)
+	if code != codes.Unavailable && code != codes.ResourceExhausted {
+		return nil, false
+	}
+	pushback := p.pushback(ctx, code)
+	if pushback <= 0 {
+		return nil, false
+	}
+	return metadata.Pairs(retryPushbackTrailer, strconv.FormatInt(pushback.Milliseconds(), 10)), true
+}
+
+// retryPushbackFunc returns the configured pushback func, a fixed pushback, or nil if neither is configured
+func (s *GrpcServer) retryPushbackFunc() RetryPushbackFunc {
+	if s.Config.RetryPushbackFunc != nil {
+		return s.Config.RetryPushbackFunc
+	}
+	if s.Config.RetryPushback > 0 {
+		return func(context.Context, codes.Code) time.Duration {
+			return s.Config.RetryPushback
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/catalystsquad/app-utils-go/env"
+	"github.com/catalystsquad/app-utils-go/logging"
+	sentryutils "github.com/catalystsquad/app-utils-go/sentry"
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// sentryFlushTimeout is how long shutdown waits for buffered sentry events to be sent
+const sentryFlushTimeout = 2 * time.Second
+
+// SentryHub returns the hub this server captures sentry events through, or nil if sentry isn't enabled. Use it to
+// capture events to the same project as the server.
+func (s *GrpcServer) SentryHub() *sentry.Hub {
+	return s.sentryHub
+}
+
+var registerSentryLogHook sync.Once
+
+// maybeInitSentry creates a sentry client and hub for this server if configured to do so. The hub isn't the global
+// one, so servers in the same process can report to different projects and environments. The SENTRY_* environment
+// variables read by app-utils-go apply the same way they do to the global client. The hub is put on the server's log
+// entry so that everything the server logs at error level or above, including recovered panics in handlers and
+// background jobs, is captured through it, like the app-utils-go logrus hook does for the global hub.
+func (s *GrpcServer) maybeInitSentry() error {
+	if !s.Config.SentryEnabled || !sentryutils.SentryEnabled {
+		return nil
+	}
+	options := s.Config.SentryClientOptions
+	options.SampleRate = sentryutils.SampleRate
+	options.TracesSampleRate = sentryutils.TracesSampleRate
+	options.Debug = sentryutils.SentryDebug
+	options.AttachStacktrace = true
+	client, err := sentry.NewClient(options)
+	if err != nil {
+		return fmt.Errorf("error initializing sentry: %w", err)
+	}
+	tags := map[string]string{}
+	if err = json.Unmarshal([]byte(sentryutils.AdditionalSentryTags), &tags); err != nil {
+		return fmt.Errorf("ADDITIONAL_SENTRY_TAGS is invalid, it should be json that maps to a map[string]string: %w", err)
+	}
+	// the same tags the app-utils-go logrus hook adds to events captured through the global hub
+	tags["namespace"] = env.GetEnvOrDefault("POD_NAMESPACE", "local")
+	tags["pod_name"] = env.GetEnvOrDefault("HOSTNAME", "local")
+	if s.Config.ServiceName != "" {
+		tags["service"] = s.Config.ServiceName
+	}
+	scope := sentry.NewScope()
+	scope.SetTags(tags)
+	scope.AddEventProcessor(fingerprintEventProcessor)
+	s.sentryHub = sentry.NewHub(client, scope)
+	s.log = s.log.WithContext(sentry.SetHubOnContext(context.Background(), s.sentryHub))
+	registerSentryLogHook.Do(func() {
+		logging.Log.AddHook(sentryLogHook{})
+	})
+	return nil
+}
+
+// sentryLogHook captures error level log entries through the sentry hub on the entry's context. Entries without one,
+// i.e. not logged by a server with sentry enabled, are ignored.
+type sentryLogHook struct{}
+
+func (sentryLogHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+func (sentryLogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	hub := sentry.GetHubFromContext(entry.Context)
+	if hub == nil {
+		return nil
+	}
+	err, ok := entry.Data[logrus.ErrorKey].(error)
+	if !ok {
+		err = errors.New(entry.Message)
+	}
+	hub.CaptureException(err)
+	return nil
+}
@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strconv"
+	"time"
+)
+
+const serverProcessingTimeTrailer = "grpc-server-processing-time"
+
+// serverTimingUnaryInterceptor sets a trailer with the handler duration in milliseconds
+func serverTimingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	// trailers are best effort, failing to set one shouldn't fail the call
+	_ = grpc.SetTrailer(ctx, serverTimingTrailer(time.Since(start)))
+	return resp, err
+}
+
+// serverTimingStreamInterceptor sets a trailer with the stream handler duration in milliseconds
+func serverTimingStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	ss.SetTrailer(serverTimingTrailer(time.Since(start)))
+	return err
+}
+
+func serverTimingTrailer(duration time.Duration) metadata.MD {
+	milliseconds := float64(duration) / float64(time.Millisecond)
+	return metadata.Pairs(serverProcessingTimeTrailer, strconv.FormatFloat(milliseconds, 'f', 3, 64))
+}
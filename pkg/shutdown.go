@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"context"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const defaultGracefulStopTimeout = 30 * time.Second
+const httpShutdownTimeout = 5 * time.Second
+const defaultShutdownHookTimeout = 10 * time.Second
+
+// errShuttingDown is returned to streams that are active while the server shuts down
+var errShuttingDown = status.Error(codes.Unavailable, "server shutting down")
+
+// shutdown runs the shutdown sequence. The gRPC server drains first, then the shutdown hooks run, and the metrics
+// server stops last so that scrapers still see the final metrics.
+func (s *GrpcServer) shutdown() {
+	s.setShuttingDown()
+	s.shutdownHTTPServer(s.grpcWebServer, "grpc-web")
+	s.gracefulStop()
+	s.runShutdownHooks()
+	if s.metricsServer != nil {
+		time.Sleep(s.Config.MetricsShutdownDelay)
+		s.shutdownHTTPServer(s.metricsServer, "metrics")
+	}
+	if s.sentryHub != nil {
+		s.sentryHub.Flush(sentryFlushTimeout)
+	}
+}
+
+// gracefulStop stops the gRPC server, waiting for in flight rpcs up to the graceful stop timeout before forcing it
+func (s *GrpcServer) gracefulStop() {
+	stopped := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+	timer := time.NewTimer(s.Config.GracefulStopTimeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.log.Warn("timed out waiting for gRPC server to stop gracefully, forcing it to stop")
+		s.setForceStopped()
+		s.Server.Stop()
+		<-stopped
+	}
+}
+
+// runShutdownHooks runs the shutdown hooks in order, each with its own timeout. Errors are logged and don't stop later
+// hooks from running.
+func (s *GrpcServer) runShutdownHooks() {
+	for i, hook := range s.Config.ShutdownHooks {
+		ctx, cancel := context.WithTimeout(context.Background(), s.Config.ShutdownHookTimeout)
+		err := hook(ctx)
+		cancel()
+		errorutils.LogOnErr(s.log.WithField("shutdown_hook", i), "error running shutdown hook", err)
+	}
+}
+
+// shutdownHTTPServer gracefully shuts down an http server if it exists
+func (s *GrpcServer) shutdownHTTPServer(server *http.Server, name string) {
+	if server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	errorutils.LogOnErr(s.log, "error shutting down "+name+" server", server.Shutdown(ctx))
+}
+
+// setShuttingDown flips the server into the shutting down state
+func (s *GrpcServer) setShuttingDown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
+// isShuttingDown returns true once the server has started shutting down
+func (s *GrpcServer) isShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+// setForceStopped records that the graceful stop timed out and the remaining streams are being cut off
+func (s *GrpcServer) setForceStopped() {
+	atomic.StoreInt32(&s.forceStopped, 1)
+}
+
+// isForceStopped returns true once the graceful stop has timed out
+func (s *GrpcServer) isForceStopped() bool {
+	return atomic.LoadInt32(&s.forceStopped) == 1
+}
+
+// shutdownStreamInterceptor rejects new streams once the server is shutting down. Streams already active keep running
+// while the server drains, and only if they're cut off by the graceful stop timeout do they end with a clean
+// Unavailable status rather than whatever error the handler gets from the closing transport.
+func (s *GrpcServer) shutdownStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if s.isShuttingDown() {
+		return errShuttingDown
+	}
+	err := handler(srv, &shutdownServerStream{ServerStream: ss, server: s})
+	if err != nil && s.isForceStopped() {
+		return errShuttingDown
+	}
+	return err
+}
+
+// shutdownServerStream fails sends and receives with Unavailable once the server has been forced to stop
+type shutdownServerStream struct {
+	grpc.ServerStream
+	server *GrpcServer
+}
+
+func (s *shutdownServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err != nil && s.server.isForceStopped() {
+		return errShuttingDown
+	}
+	return err
+}
+
+func (s *shutdownServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil && err != io.EOF && s.server.isForceStopped() {
+		return errShuttingDown
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"runtime"
+	"sync/atomic"
+)
+
+// requestCoalescer executes the handler once for identical concurrent requests to opted in methods and shares the
+// result with every caller
+type requestCoalescer struct {
+	methods map[string]bool
+	group   singleflight.Group
+}
+
+func newRequestCoalescer(methods []string) *requestCoalescer {
+	enabled := map[string]bool{}
+	for _, method := range methods {
+		enabled[method] = true
+	}
+	return &requestCoalescer{
+		methods: enabled,
+	}
+}
+
+func (c *requestCoalescer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !c.methods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	key, ok := c.key(info.FullMethod, req)
+	if !ok {
+		return handler(ctx, req)
+	}
+	return doShared(&c.group, key, func() (interface{}, error) {
+		// the first caller's context is used, so its cancellation affects everyone waiting on the result
+		return handler(ctx, req)
+	})
+}
+
+// sharedPanic is what a handler run through singleflight panicked with, along with the stack it panicked on. Every
+// caller sharing the call re-panics with it, and the recovery handler unwraps it so the panic is handled with the
+// handler's value and stack rather than singleflight's wrapper, and reported once rather than once per caller.
+type sharedPanic struct {
+	value    interface{}
+	stack    []runtime.Frame
+	reported int32
+}
+
+// claimReport returns true for the first caller only, the one that reports the panic
+func (p *sharedPanic) claimReport() bool {
+	return atomic.CompareAndSwapInt32(&p.reported, 0, 1)
+}
+
+// String shows the original panic value if the panic crashes the process because recovery is disabled
+func (p *sharedPanic) String() string {
+	return fmt.Sprint(p.value)
+}
+
+// doShared runs fn once for concurrent calls with the same key. If fn panics every caller re-panics with a sharedPanic.
+func doShared(group *singleflight.Group, key string, fn func() (interface{}, error)) (interface{}, error) {
+	resp, err, _ := group.Do(key, func() (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				// returned rather than panicked through singleflight, which would wrap the value
+				resp, err = &sharedPanic{value: p, stack: panicStack()}, nil
+			}
+		}()
+		return fn()
+	})
+	if shared, ok := resp.(*sharedPanic); ok {
+		panic(shared)
+	}
+	return resp, err
+}
+
+// key returns the method plus the deterministically serialized request, and false if the request can't be serialized
+func (c *requestCoalescer) key(method string, req interface{}) (string, bool) {
+	protoMsg, ok := req.(proto.Message)
+	if !ok {
+		return "", false
+	}
+	serialized, err := proto.MarshalOptions{Deterministic: true}.Marshal(protoMsg)
+	if err != nil {
+		return "", false
+	}
+	return method + ":" + string(serialized), true
+}
@@ -0,0 +1,25 @@
+package pkg
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenConfig returns the listen config for gRPC listeners, setting the configured socket options
+func (s *GrpcServer) listenConfig() net.ListenConfig {
+	if !s.Config.ReuseAddr && !s.Config.ReusePort {
+		return net.ListenConfig{}
+	}
+	return net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			var sockErr error
+			err := conn.Control(func(fd uintptr) {
+				sockErr = setReuseSocketOptions(fd, s.Config.ReuseAddr, s.Config.ReusePort)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package pkg
+
+import (
+	"errors"
+)
+
+// setReuseSocketOptions is not supported on this platform
+func setReuseSocketOptions(fd uintptr, reuseAddr, reusePort bool) error {
+	return errors.New("ReuseAddr and ReusePort are not supported on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package pkg
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setReuseSocketOptions sets SO_REUSEADDR and SO_REUSEPORT on the socket
+func setReuseSocketOptions(fd uintptr, reuseAddr, reusePort bool) error {
+	if reuseAddr {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+			return err
+		}
+	}
+	if reusePort {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"os"
+	"runtime"
+	"sync/atomic"
+)
+
+// DumpState logs a snapshot of the server state at info level for live debugging: open connections, in flight
+// requests, goroutine count, health status, and the effective config. Connections and requests aren't counted if a
+// stats handler is configured in Opts.
+func (s *GrpcServer) DumpState() {
+	healthStatus := grpc_health_v1.HealthCheckResponse_UNKNOWN.String()
+	if s.Config.HealthServer != nil {
+		response, err := s.Config.HealthServer.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		if err != nil {
+			healthStatus = err.Error()
+		} else {
+			healthStatus = response.Status.String()
+		}
+	}
+	s.log.WithFields(s.effectiveConfigFields()).WithFields(logrus.Fields{
+		"active_connections": atomic.LoadInt64(&s.activeGauges.connectionCount),
+		"inflight_requests":  atomic.LoadInt64(&s.activeGauges.streamCount),
+		"goroutines":         runtime.NumGoroutine(),
+		"health_status":      healthStatus,
+		"shutting_down":      s.isShuttingDown(),
+	}).Info("gRPC server state")
+}
+
+// dumpStateOnSignal dumps the server state every time a signal is received, until shutdown
+func (s *GrpcServer) dumpStateOnSignal(signals <-chan os.Signal) {
+	s.Go(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				s.DumpState()
+			}
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StateStore is a key value store with expiry for interceptor state such as idempotency records. The in-memory
+// implementation only shares state within one process, implement it with a shared store like redis for cluster wide
+// semantics.
+type StateStore interface {
+	// Get returns the value for the key, and false if there is no unexpired value
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set sets the value for the key, expiring after ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Incr increments the integer value of the key and returns the new value. A missing key starts at 0 and expires
+	// after ttl, incrementing an existing key doesn't change its expiry. Like redis, values are stored as decimal strings.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// NewMemoryStateStore creates an in-memory state store with no limits, see NewMemoryStateStoreWithLimits
+func NewMemoryStateStore() *MemoryStateStore {
+	return NewMemoryStateStoreWithLimits(MemoryStoreLimits{})
+}
+
+// NewMemoryStateStoreWithLimits creates an in-memory state store that evicts the least recently used entries past the
+// max entries and caps entry lifetimes at the max ttl
+func NewMemoryStateStoreWithLimits(limits MemoryStoreLimits) *MemoryStateStore {
+	return &MemoryStateStore{
+		lru: newLRUStore(limits),
+	}
+}
+
+type MemoryStateStore struct {
+	lru *lruStore
+}
+
+func (m *MemoryStateStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok := m.lru.get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return value.([]byte), true, nil
+}
+
+func (m *MemoryStateStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.lru.set(key, value, ttl)
+	return nil
+}
+
+func (m *MemoryStateStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.lru.lock.Lock()
+	defer m.lru.lock.Unlock()
+	value, expiresAt := []byte("0"), m.lru.expiresAt(ttl)
+	if entry, ok := m.lru.getEntry(key); ok {
+		value, expiresAt = entry.value.([]byte), entry.expiresAt
+	}
+	current, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	current++
+	m.lru.setEntry(key, []byte(strconv.FormatInt(current, 10)), expiresAt)
+	return current, nil
+}
+
+// marshalStoredMessage serializes a proto for a state store, along with its type name so it can be unmarshalled
+// without knowing the type up front
+func marshalStoredMessage(message proto.Message) ([]byte, error) {
+	serialized, err := proto.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(string(message.ProtoReflect().Descriptor().FullName())+"\n"), serialized...), nil
+}
+
+// unmarshalStoredMessage unmarshals a proto serialized by marshalStoredMessage, the type must be registered
+func unmarshalStoredMessage(value []byte) (proto.Message, error) {
+	// values are the message type name, a newline, then the serialized message
+	typeName, serialized, found := strings.Cut(string(value), "\n")
+	if !found {
+		return nil, errors.New("stored message is missing its type name")
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, err
+	}
+	message := messageType.New().Interface()
+	if err = proto.Unmarshal([]byte(serialized), message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/stats"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnInfo describes an open connection to the gRPC server
+type ConnInfo struct {
+	RemoteAddr    net.Addr
+	LocalAddr     net.Addr
+	ConnectedAt   time.Time
+	Age           time.Duration
+	ActiveStreams int64 // active streams on the connection, unary calls count as streams like they do on the wire
+}
+
+// activeGaugesHandler is a stats handler counting open connections and active streams, unary calls count as streams
+// like they do on the wire. It also tracks each open connection for ActiveConnections and state dumps. The counts are
+// only exported as gauges when prometheus is enabled.
+type activeGaugesHandler struct {
+	connections     prometheus.Gauge // nil when prometheus is disabled
+	streams         prometheus.Gauge // nil when prometheus is disabled
+	connectionCount int64
+	streamCount     int64
+	lock            sync.Mutex
+	conns           map[*connState]bool
+}
+
+// connState is the tracked state of one connection, stored on the connection context
+type connState struct {
+	remoteAddr    net.Addr
+	localAddr     net.Addr
+	connectedAt   time.Time
+	activeStreams int64
+}
+
+type connStateContextKey struct{}
+
+// newActiveGaugesHandler creates the handler, registering its gauges only if prometheusEnabled is set
+func newActiveGaugesHandler(namespace string, prometheusEnabled bool) *activeGaugesHandler {
+	handler := &activeGaugesHandler{conns: map[*connState]bool{}}
+	if !prometheusEnabled {
+		return handler
+	}
+	connections := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "grpc_connections_active",
+		Help:      "Number of currently open connections to the gRPC server.",
+	})
+	streams := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "grpc_streams_active",
+		Help:      "Number of currently active streams, including unary calls, on the gRPC server.",
+	})
+	handler.connections = registerCollector(connections).(prometheus.Gauge)
+	handler.streams = registerCollector(streams).(prometheus.Gauge)
+	return handler
+}
+
+func (h *activeGaugesHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *activeGaugesHandler) HandleRPC(ctx context.Context, rpcStats stats.RPCStats) {
+	// rpc contexts are derived from the connection context, so they carry the connection state
+	conn, _ := ctx.Value(connStateContextKey{}).(*connState)
+	switch rpcStats.(type) {
+	case *stats.Begin:
+		atomic.AddInt64(&h.streamCount, 1)
+		addToGauge(h.streams, 1)
+		if conn != nil {
+			atomic.AddInt64(&conn.activeStreams, 1)
+		}
+	case *stats.End:
+		atomic.AddInt64(&h.streamCount, -1)
+		addToGauge(h.streams, -1)
+		if conn != nil {
+			atomic.AddInt64(&conn.activeStreams, -1)
+		}
+	}
+}
+
+func (h *activeGaugesHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connStateContextKey{}, &connState{
+		remoteAddr:  info.RemoteAddr,
+		localAddr:   info.LocalAddr,
+		connectedAt: time.Now(),
+	})
+}
+
+func (h *activeGaugesHandler) HandleConn(ctx context.Context, connStats stats.ConnStats) {
+	conn, _ := ctx.Value(connStateContextKey{}).(*connState)
+	switch connStats.(type) {
+	case *stats.ConnBegin:
+		atomic.AddInt64(&h.connectionCount, 1)
+		addToGauge(h.connections, 1)
+		if conn != nil {
+			h.lock.Lock()
+			h.conns[conn] = true
+			h.lock.Unlock()
+		}
+	case *stats.ConnEnd:
+		atomic.AddInt64(&h.connectionCount, -1)
+		addToGauge(h.connections, -1)
+		if conn != nil {
+			h.lock.Lock()
+			delete(h.conns, conn)
+			h.lock.Unlock()
+		}
+	}
+}
+
+// addToGauge adds to the gauge if there is one, the gauges are nil when prometheus is disabled
+func addToGauge(gauge prometheus.Gauge, value float64) {
+	if gauge != nil {
+		gauge.Add(value)
+	}
+}
+
+// activeConnections returns the open connections, oldest first
+func (h *activeGaugesHandler) activeConnections() []ConnInfo {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	now := time.Now()
+	infos := make([]ConnInfo, 0, len(h.conns))
+	for conn := range h.conns {
+		infos = append(infos, ConnInfo{
+			RemoteAddr:    conn.remoteAddr,
+			LocalAddr:     conn.localAddr,
+			ConnectedAt:   conn.connectedAt,
+			Age:           now.Sub(conn.connectedAt),
+			ActiveStreams: atomic.LoadInt64(&conn.activeStreams),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	return infos
+}
+
+// ActiveConnections returns the connections open to the gRPC server, oldest first, for debugging stuck clients. Always
+// empty if a stats handler is configured in Opts, since grpc only supports one and the configured one takes precedence.
+func (s *GrpcServer) ActiveConnections() []ConnInfo {
+	return s.activeGauges.activeConnections()
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// CollectingServerStream is a server stream that collects sent messages instead of writing them to the network. It
+// satisfies generated server streaming interfaces, e.g. Service_MethodServer, when Resp is the response pointer type.
+type CollectingServerStream[Resp any] struct {
+	ctx         context.Context
+	maxMessages int
+	Messages    []Resp
+}
+
+// Send collects the message, returning ResourceExhausted once the max number of messages has been collected
+func (s *CollectingServerStream[Resp]) Send(m Resp) error {
+	if s.maxMessages > 0 && len(s.Messages) >= s.maxMessages {
+		return status.Errorf(codes.ResourceExhausted, "response exceeds the max of %d messages", s.maxMessages)
+	}
+	s.Messages = append(s.Messages, m)
+	return nil
+}
+
+func (s *CollectingServerStream[Resp]) SendMsg(m interface{}) error {
+	typed, ok := m.(Resp)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message type %T", m)
+	}
+	return s.Send(typed)
+}
+
+func (s *CollectingServerStream[Resp]) RecvMsg(m interface{}) error {
+	return errors.New("RecvMsg is not supported when collecting a server stream")
+}
+
+// SetHeader forwards headers to the unary call
+func (s *CollectingServerStream[Resp]) SetHeader(md metadata.MD) error {
+	return grpc.SetHeader(s.ctx, md)
+}
+
+// SendHeader forwards headers to the unary call, they're sent with the unary response
+func (s *CollectingServerStream[Resp]) SendHeader(md metadata.MD) error {
+	return grpc.SetHeader(s.ctx, md)
+}
+
+// SetTrailer forwards trailers to the unary call
+func (s *CollectingServerStream[Resp]) SetTrailer(md metadata.MD) {
+	// the stream interface has no way to return the error, trailers just won't be sent
+	_ = grpc.SetTrailer(s.ctx, md)
+}
+
+func (s *CollectingServerStream[Resp]) Context() context.Context {
+	return s.ctx
+}
+
+// CollectServerStream calls a server streaming handler from a unary handler and returns the messages it sent, so a
+// streaming method can also be served as a unary one. At most maxMessages are collected, 0 means unlimited, sending
+// more fails the handler's send with ResourceExhausted. For example:
+//
+//	messages, err := pkg.CollectServerStream(ctx, req, 1000, func(req *pb.ListRequest, stream *pkg.CollectingServerStream[*pb.Item]) error {
+//		return s.ListStream(req, stream)
+//	})
+func CollectServerStream[Req any, Resp any](ctx context.Context, req Req, maxMessages int, handler func(Req, *CollectingServerStream[Resp]) error) ([]Resp, error) {
+	if maxMessages < 0 {
+		return nil, fmt.Errorf("max messages must not be negative, got %d", maxMessages)
+	}
+	stream := &CollectingServerStream[Resp]{
+		ctx:         ctx,
+		maxMessages: maxMessages,
+	}
+	err := handler(req, stream)
+	return stream.Messages, err
+}
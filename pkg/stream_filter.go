@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"google.golang.org/grpc"
+)
+
+// FilterStreamInterceptor returns a stream interceptor that only runs the given interceptor for streams matching the
+// filter, other streams go straight to the handler
+func FilterStreamInterceptor(interceptor grpc.StreamServerInterceptor, filter func(info *grpc.StreamServerInfo) bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !filter(info) {
+			return handler(srv, ss)
+		}
+		return interceptor(srv, ss, info, handler)
+	}
+}
+
+// BidiStreamInterceptor returns a stream interceptor that only runs the given interceptor for bidirectional streams
+func BidiStreamInterceptor(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return FilterStreamInterceptor(interceptor, func(info *grpc.StreamServerInfo) bool {
+		return info.IsClientStream && info.IsServerStream
+	})
+}
+
+// ClientStreamInterceptor returns a stream interceptor that only runs the given interceptor for client streams
+func ClientStreamInterceptor(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return FilterStreamInterceptor(interceptor, func(info *grpc.StreamServerInfo) bool {
+		return info.IsClientStream && !info.IsServerStream
+	})
+}
+
+// ServerStreamInterceptor returns a stream interceptor that only runs the given interceptor for server streams
+func ServerStreamInterceptor(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return FilterStreamInterceptor(interceptor, func(info *grpc.StreamServerInfo) bool {
+		return !info.IsClientStream && info.IsServerStream
+	})
+}
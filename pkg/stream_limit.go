@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamMessageLimiter caps how many messages a handler can send on one stream, guarding against runaway streams
+type streamMessageLimiter struct {
+	defaultMax int
+	methodMax  map[string]int
+}
+
+func newStreamMessageLimiter(defaultMax int, methodMax map[string]int) *streamMessageLimiter {
+	return &streamMessageLimiter{
+		defaultMax: defaultMax,
+		methodMax:  methodMax,
+	}
+}
+
+func (l *streamMessageLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	max, ok := l.methodMax[info.FullMethod]
+	if !ok {
+		max = l.defaultMax
+	}
+	if max <= 0 || !info.IsServerStream {
+		return handler(srv, ss)
+	}
+	return handler(srv, &limitedServerStream{ServerStream: ss, max: max})
+}
+
+// limitedServerStream fails sends with ResourceExhausted once the max messages have been sent
+type limitedServerStream struct {
+	grpc.ServerStream
+	max  int
+	sent int
+}
+
+func (s *limitedServerStream) SendMsg(m interface{}) error {
+	if s.sent >= s.max {
+		return status.Errorf(codes.ResourceExhausted, "stream exceeded the max of %d messages", s.max)
+	}
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"regexp"
+	"sync"
+)
+
+const defaultTenantMaxCardinality = 100
+const tenantLabelNone = "none"
+const tenantLabelInvalid = "invalid"
+const tenantLabelOther = "other"
+
+var validTenant = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+type tenantContextKey struct{}
+
+// TenantFromContext returns the tenant id extracted from request metadata by the tenant interceptor, and whether one
+// was present
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok
+}
+
+// tenantTagger reads the tenant from request metadata, stores it in the context, and counts handled requests per tenant.
+// Panics recovered from requests are tagged with the tenant in sentry, see logWithTenantHub.
+type tenantTagger struct {
+	metadataKey    string
+	allowlist      map[string]bool
+	maxCardinality int
+	handled        *prometheus.CounterVec
+	seenLock       sync.Mutex
+	seen           map[string]bool
+}
+
+func newTenantTagger(namespace, metadataKey string, allowlist []string, maxCardinality int) *tenantTagger {
+	allowed := map[string]bool{}
+	for _, tenant := range allowlist {
+		allowed[tenant] = true
+	}
+	handled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_tenant_handled_total",
+		Help:      "Total number of RPCs completed on the server, by tenant.",
+	}, []string{"grpc_method", "grpc_code", "tenant"})
+	return &tenantTagger{
+		metadataKey:    metadataKey,
+		allowlist:      allowed,
+		maxCardinality: maxCardinality,
+		handled:        registerCollector(handled).(*prometheus.CounterVec),
+		seen:           map[string]bool{},
+	}
+}
+
+func (t *tenantTagger) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, label := t.tag(ctx)
+	resp, err := handler(ctx, req)
+	t.handled.WithLabelValues(info.FullMethod, status.Code(err).String(), label).Inc()
+	return resp, err
+}
+
+func (t *tenantTagger) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, label := t.tag(ss.Context())
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = ctx
+	err := handler(srv, wrapped)
+	t.handled.WithLabelValues(info.FullMethod, status.Code(err).String(), label).Inc()
+	return err
+}
+
+// tag extracts the tenant from metadata and returns a context carrying it along with the metric label to use
+func (t *tenantTagger) tag(ctx context.Context) (context.Context, string) {
+	tenant := t.fromMetadata(ctx)
+	if tenant == "" {
+		return ctx, tenantLabelNone
+	}
+	if !validTenant.MatchString(tenant) {
+		return ctx, tenantLabelInvalid
+	}
+	ctx = context.WithValue(ctx, tenantContextKey{}, tenant)
+	return ctx, t.label(tenant)
+}
+
+// label bounds metric cardinality. Allowlisted tenants are always labelled, otherwise without an allowlist the first
+// maxCardinality distinct tenants are labelled and the rest are grouped under "other"
+func (t *tenantTagger) label(tenant string) string {
+	if len(t.allowlist) > 0 {
+		if t.allowlist[tenant] {
+			return tenant
+		}
+		return tenantLabelOther
+	}
+	t.seenLock.Lock()
+	defer t.seenLock.Unlock()
+	if t.seen[tenant] {
+		return tenant
+	}
+	if len(t.seen) < t.maxCardinality {
+		t.seen[tenant] = true
+		return tenant
+	}
+	return tenantLabelOther
+}
+
+// fromMetadata returns the tenant in the request metadata, empty if there is none
+func (t *tenantTagger) fromMetadata(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(t.metadataKey); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// logWithTenantHub returns the server log entry, capturing through a clone of the server's sentry hub tagged with the
+// request's tenant if there is one. Recovery runs outside the tenant interceptor so the tenant is read from metadata
+// rather than the context.
+func (s *GrpcServer) logWithTenantHub(ctx context.Context) *logrus.Entry {
+	if s.tenantTagger == nil || s.sentryHub == nil {
+		return s.log
+	}
+	tenant := s.tenantTagger.fromMetadata(ctx)
+	if !validTenant.MatchString(tenant) {
+		return s.log
+	}
+	hub := s.sentryHub.Clone()
+	hub.Scope().SetTag("tenant", tenant)
+	return s.log.WithContext(sentry.SetHubOnContext(context.Background(), hub))
+}
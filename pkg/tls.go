@@ -0,0 +1,142 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/catalystsquad/app-utils-go/errorutils"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"software.sslmate.com/src/go-pkcs12"
+	"sync"
+	"time"
+)
+
+// certificateHolder holds the served certificate so that it can be swapped safely while handshakes are in progress
+type certificateHolder struct {
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+}
+
+// getCertificate is used as tls.Config.GetCertificate so every handshake reads the current certificate
+func (h *certificateHolder) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.certificate, nil
+}
+
+// setCertificate replaces the served certificate. Any OCSP staple is dropped since it belongs to the old certificate.
+func (h *certificateHolder) setCertificate(certificate *tls.Certificate) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.certificate = certificate
+}
+
+// setOCSPStaple staples the OCSP response to the served certificate
+func (h *certificateHolder) setOCSPStaple(staple []byte) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	// copy rather than modify in place, the current certificate may be in use by in progress handshakes
+	stapled := *h.certificate
+	stapled.OCSPStaple = staple
+	h.certificate = &stapled
+}
+
+// ReloadTLSCertificates reloads the tls cert and key, or PKCS#12 bundle, from the configured paths. New handshakes use
+// the reloaded certificate, existing connections are unaffected. The new certificate is fully validated before it's
+// swapped in, so if the files are invalid, e.g. partially written during renewal, the error is logged and returned and
+// the current certificate keeps being served. Safe to call concurrently.
+func (s *GrpcServer) ReloadTLSCertificates() error {
+	if s.certificateHolder == nil {
+		return errors.New("tls is not enabled")
+	}
+	certificate, err := s.loadValidServerCertificate()
+	if err != nil {
+		s.log.WithError(err).WithFields(logrus.Fields{
+			"cert_path":   s.Config.TlsCertPath,
+			"key_path":    s.Config.TlsKeyPath,
+			"pkcs12_path": s.Config.TlsPkcs12Path,
+		}).Error("error reloading tls certificates, keeping the current certificate")
+		return err
+	}
+	s.certificateHolder.setCertificate(&certificate)
+	s.log.WithFields(logrus.Fields{
+		"cert_path":   s.Config.TlsCertPath,
+		"key_path":    s.Config.TlsKeyPath,
+		"pkcs12_path": s.Config.TlsPkcs12Path,
+	}).Info("reloaded tls certificates")
+	if s.Config.TlsOcspResponseURL != "" {
+		// the previous staple was for the old certificate
+		errorutils.LogOnErr(s.log, "error refreshing ocsp staple after tls reload", s.refreshOCSPStaple(context.Background()))
+	}
+	return nil
+}
+
+// loadValidServerCertificate loads the server certificate and checks that the leaf parses and is currently valid
+func (s *GrpcServer) loadValidServerCertificate() (tls.Certificate, error) {
+	certificate, _, err := s.loadServerCertificate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if certificate.Leaf == nil {
+		certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	now := time.Now()
+	if now.Before(certificate.Leaf.NotBefore) || now.After(certificate.Leaf.NotAfter) {
+		return tls.Certificate{}, fmt.Errorf("certificate is only valid from %s to %s", certificate.Leaf.NotBefore, certificate.Leaf.NotAfter)
+	}
+	return certificate, nil
+}
+
+// tlsEnabled returns true if either the pem cert, key, and ca paths, or a PKCS#12 bundle path are configured
+func (s *GrpcServer) tlsEnabled() bool {
+	return (s.Config.TlsCertPath != "" && s.Config.TlsKeyPath != "" && s.Config.TlsCaPath != "") || s.Config.TlsPkcs12Path != ""
+}
+
+// loadServerCertificate loads the server certificate from the PKCS#12 bundle if configured, otherwise from the pem cert
+// and key. Also returns any ca certificates included in the bundle.
+func (s *GrpcServer) loadServerCertificate() (tls.Certificate, []*x509.Certificate, error) {
+	if s.Config.TlsPkcs12Path == "" {
+		certificate, err := tls.LoadX509KeyPair(s.Config.TlsCertPath, s.Config.TlsKeyPath)
+		return certificate, nil, err
+	}
+	data, err := ioutil.ReadFile(s.Config.TlsPkcs12Path)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	key, leaf, caCerts, err := pkcs12.DecodeChain(data, s.Config.TlsPkcs12Password)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	certificate := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	// serve the intermediates from the bundle along with the leaf
+	for _, caCert := range caCerts {
+		certificate.Certificate = append(certificate.Certificate, caCert.Raw)
+	}
+	return certificate, caCerts, nil
+}
+
+// loadCertPool creates a cert pool from the ca file, if set, plus any additional certificates
+func loadCertPool(caPath string, additional []*x509.Certificate) (*x509.CertPool, error) {
+	p := x509.NewCertPool()
+	if caPath != "" {
+		ca, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, err
+		}
+		p.AppendCertsFromPEM(ca)
+	}
+	for _, cert := range additional {
+		p.AddCert(cert)
+	}
+	return p, nil
+}
@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+	"io"
+	"net"
+	"strings"
+)
+
+// handshakeObservingCredentials wraps transport credentials to log and count failed server handshakes, which otherwise
+// fail in the transport before any interceptor sees them
+type handshakeObservingCredentials struct {
+	credentials.TransportCredentials
+	log      *logrus.Entry
+	failures *prometheus.CounterVec
+}
+
+func newHandshakeObservingCredentials(creds credentials.TransportCredentials, log *logrus.Entry, namespace string, recordMetrics bool) *handshakeObservingCredentials {
+	observing := &handshakeObservingCredentials{
+		TransportCredentials: creds,
+		log:                  log,
+	}
+	if recordMetrics {
+		failures := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_tls_handshake_failures_total",
+			Help:      "Total number of failed tls handshakes, by reason.",
+		}, []string{"reason"})
+		observing.failures = registerCollector(failures).(*prometheus.CounterVec)
+	}
+	return observing
+}
+
+func (c *handshakeObservingCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := c.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		reason := tlsHandshakeFailureReason(err)
+		c.log.WithError(err).WithFields(logrus.Fields{
+			"remote_addr": rawConn.RemoteAddr().String(),
+			"reason":      reason,
+		}).Warn("tls handshake failed")
+		if c.failures != nil {
+			c.failures.WithLabelValues(reason).Inc()
+		}
+	}
+	return conn, authInfo, err
+}
+
+func (c *handshakeObservingCredentials) Clone() credentials.TransportCredentials {
+	return &handshakeObservingCredentials{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		log:                  c.log,
+		failures:             c.failures,
+	}
+}
+
+// tlsHandshakeFailureReason classifies a handshake error into a bounded set of reasons. The tls package doesn't export
+// typed errors for most failures so this matches on the error message.
+func tlsHandshakeFailureReason(err error) string {
+	if errors.Is(err, io.EOF) {
+		return "eof"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "unknown authority"):
+		return "unknown_authority"
+	case strings.Contains(message, "certificate"):
+		return "bad_certificate"
+	case strings.Contains(message, "protocol version") || strings.Contains(message, "no supported versions"):
+		return "protocol_version"
+	case strings.Contains(message, "cipher"):
+		return "cipher_suite"
+	case strings.Contains(message, "first record does not look like a TLS handshake"):
+		return "not_tls"
+	}
+	return "other"
+}
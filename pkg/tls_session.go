@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+// maybeConfigureSessionTickets configures tls session resumption on the primary tls config. Without configured keys go
+// generates and rotates its own, which works for resumption against a single replica. Sharing keys lets clients resume
+// against any replica, rotate them with SetTLSSessionTicketKeys.
+func (s *GrpcServer) maybeConfigureSessionTickets(config *tls.Config) {
+	if s.Config.TlsSessionTicketsDisabled {
+		config.SessionTicketsDisabled = true
+		return
+	}
+	if len(s.Config.TlsSessionTicketKeys) == 0 {
+		return
+	}
+	// grpc credentials clone the config, so later key changes have to go through a config returned per handshake
+	ticketConfig := config.Clone()
+	if len(ticketConfig.NextProtos) == 0 {
+		ticketConfig.NextProtos = []string{"h2"}
+	}
+	ticketConfig.SetSessionTicketKeys(s.Config.TlsSessionTicketKeys)
+	s.sessionTicketConfig = ticketConfig
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return ticketConfig, nil
+	}
+}
+
+// SetTLSSessionTicketKeys replaces the session ticket keys. The first key encrypts new tickets and all of them decrypt,
+// so keep the previous key second while rotating to let clients resume with existing tickets. Only works when keys
+// were configured with TlsSessionTicketKeys.
+func (s *GrpcServer) SetTLSSessionTicketKeys(keys [][32]byte) error {
+	if s.sessionTicketConfig == nil {
+		return errors.New("tls session ticket keys are not configured")
+	}
+	if len(keys) == 0 {
+		return errors.New("at least one tls session ticket key is required")
+	}
+	s.sessionTicketConfig.SetSessionTicketKeys(keys)
+	s.log.WithField("keys", len(keys)).Info("set tls session ticket keys")
+	return nil
+}
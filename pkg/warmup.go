@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"context"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const warmupHealthServicePrefix = "warmup/"
+
+// AddWarmupTask adds a task that must complete before the server is ready. Tasks run in the background once the server
+// runs, and the default health server reports NOT_SERVING until every task has returned without error. Each task is
+// also reported as the named health service warmup/<name>. A failed task is logged and the server stays not ready.
+// Add tasks before calling Run().
+func (s *GrpcServer) AddWarmupTask(name string, task func(ctx context.Context) error) {
+	if task == nil {
+		s.log.WithField("warmup_task", name).Error("ignoring nil warmup task")
+		return
+	}
+	healthChecker, ok := s.Config.HealthServer.(*HealthChecker)
+	if !ok {
+		s.log.WithField("warmup_task", name).Warn("the health server is not the default, warmup task completion will not be reported")
+	} else {
+		healthChecker.SetServiceServingStatus(warmupHealthServicePrefix+name, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}
+	s.Go(func(ctx context.Context) {
+		err := task(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.WithError(err).WithField("warmup_task", name).Error("warmup task failed, the server will not become ready")
+			}
+			return
+		}
+		s.log.WithField("warmup_task", name).Info("warmup task complete")
+		if healthChecker != nil {
+			healthChecker.SetServiceServingStatus(warmupHealthServicePrefix+name, grpc_health_v1.HealthCheckResponse_SERVING)
+		}
+	})
+}